@@ -0,0 +1,64 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+const reindexBatchSize = 100
+
+type ReindexReport struct {
+	Processed int `json:"processed"`
+	Updated   int `json:"updated"`
+	Batches   int `json:"batches"`
+}
+
+// productSearchText is the denormalized text that search matches against
+func productSearchText(product *Product) string {
+	return strings.ToLower(strings.Join([]string{product.Name, product.SKU, product.Description}, " "))
+}
+
+// Reindex recomputes the derived columns of every product. Each batch is
+// written in its own transaction so a long run doesn't hold one big lock.
+func (repo *GenericRepository) Reindex() (ReindexReport, error) {
+	var report ReindexReport
+	var products []Product
+	result := repo.DB.Model(&Product{}).FindInBatches(&products, reindexBatchSize, func(batch *gorm.DB, number int) error {
+		err := repo.DB.Transaction(func(tx *gorm.DB) error {
+			for i := range products {
+				searchText := productSearchText(&products[i])
+				if products[i].SearchText == searchText {
+					continue
+				}
+				err := tx.Model(&products[i]).UpdateColumn("search_text", searchText).Error
+				if err != nil {
+					return err
+				}
+				report.Updated++
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		report.Processed += len(products)
+		report.Batches = number
+		log.Printf("Reindex: batch %d done, %d products processed", number, report.Processed)
+		return nil
+	})
+	return report, result.Error
+}
+
+// Handlers
+func ReindexProducts(w http.ResponseWriter, r *http.Request) {
+	report, err := productRepo.WithContext(r.Context()).Reindex()
+	if err != nil {
+		http.Error(w, "Error reindexing products", http.StatusInternalServerError)
+		return
+	}
+	response := ApiResponse{Success: true, Data: report, Message: "Products reindexed successfully"}
+	respondWithJSON(w, r, response)
+}
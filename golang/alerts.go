@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// How often stock levels are checked against the low-stock threshold
+const lowStockCheckInterval = 5 * time.Minute
+
+// StockAlerter is notified when a product drops to the low-stock threshold
+type StockAlerter interface {
+	LowStock(product Product, threshold int)
+}
+
+type logAlerter struct{}
+
+func (logAlerter) LowStock(product Product, threshold int) {
+	log.Printf("Low stock: product %d (%s) has %d left, threshold is %d", product.ID, product.Name, product.StockQuantity, threshold)
+}
+
+func (repo *GenericRepository) GetLowStock(threshold int) ([]Product, error) {
+	var products []Product
+	err := repo.DB.Select("id", "name", "stock_quantity").
+		Where("is_deleted = ? AND stock_quantity <= ?", false, threshold).
+		Find(&products).Error
+	if err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+// StartLowStockJob checks stock levels until ctx is cancelled. A product is
+// alerted once when it crosses the threshold and again only after it has
+// been restocked above it.
+func StartLowStockJob(ctx context.Context, wg *sync.WaitGroup, threshold int, alerter StockAlerter) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(lowStockCheckInterval)
+		defer ticker.Stop()
+		alerted := make(map[uint]bool)
+		for {
+			products, err := productRepo.GetLowStock(threshold)
+			if err != nil {
+				log.Println("Error checking low stock: ", err)
+			} else {
+				low := make(map[uint]bool, len(products))
+				for _, product := range products {
+					low[product.ID] = true
+					if !alerted[product.ID] {
+						alerter.LowStock(product, threshold)
+					}
+				}
+				alerted = low
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
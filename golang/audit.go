@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// AuditEntry records who changed a product, how, and the resulting state.
+// Entries outlive purged products, as the trail is kept for compliance.
+type AuditEntry struct {
+	ID        uint            `json:"id"`
+	ProductID uint            `json:"product_id" gorm:"index"`
+	Action    string          `json:"action"`
+	UserID    string          `json:"user_id"`
+	Snapshot  json.RawMessage `json:"snapshot" gorm:"type:text"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// Audit actions of the writes that aren't product events
+const (
+	AuditStockAdjusted      = "stock.adjusted"
+	AuditStockReserved      = "stock.reserved"
+	AuditTierCreated        = "price_tier.created"
+	AuditTierUpdated        = "price_tier.updated"
+	AuditTierDeleted        = "price_tier.deleted"
+	AuditTranslationSaved   = "translation.saved"
+	AuditTranslationDeleted = "translation.deleted"
+	AuditTagsAdded          = "tags.added"
+	AuditImagesReordered    = "images.reordered"
+	AuditCurrencyRateSaved  = "currency_rate.saved"
+	AuditIntegrityRepaired  = "integrity.repaired"
+)
+
+// recordAudit stores an entry for a product event. A failure is only logged:
+// the change it describes has already been committed.
+func recordAudit(ctx context.Context, action string, payload interface{}) {
+	var productID uint
+	switch value := payload.(type) {
+	case *Product:
+		productID = value.ID
+	case map[string]uint:
+		productID = value["id"]
+	}
+	auditChanges(ctx, []uint{productID}, action, payload)
+}
+
+// auditChanges records the same change to each of the products, for writes
+// such as stock adjustments that aren't product events. Product id 0 stands
+// for changes outside any product, such as exchange rates.
+func auditChanges(ctx context.Context, productIDs []uint, action string, payload interface{}) {
+	conn := db
+	if tx := transactionFromContext(ctx); tx != nil {
+		conn = tx
+	}
+	writeAudit(conn.WithContext(ctx), productIDs, action, payload)
+}
+
+// writeAudit stores the entries through conn, whose context names the user,
+// so writes running their own transaction can audit inside it. Failures are
+// only logged, like in recordAudit.
+func writeAudit(conn *gorm.DB, productIDs []uint, action string, payload interface{}) {
+	if len(productIDs) == 0 {
+		return
+	}
+	snapshot, err := auditSnapshot(payload)
+	if err != nil {
+		log.Println("Error encoding audit entry: ", err)
+		return
+	}
+	userID := userFromContext(conn.Statement.Context)
+	entries := make([]AuditEntry, len(productIDs))
+	for i, productID := range productIDs {
+		entries[i] = AuditEntry{ProductID: productID, Action: action, UserID: userID, Snapshot: snapshot}
+	}
+	if err := conn.CreateInBatches(&entries, 500).Error; err != nil {
+		log.Println("Error recording audit entry: ", err)
+	}
+}
+
+// auditSnapshot encodes the payload without its encrypted columns, which
+// must not end up in the audit table as cleartext. Payloads other than
+// objects, such as an image order, are kept as they are.
+func auditSnapshot(payload interface{}) (json.RawMessage, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 || data[0] != '{' {
+		return data, nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for _, column := range encryptedProductColumns {
+		delete(fields, column)
+	}
+	return json.Marshal(fields)
+}
+
+// GetAudit returns a product's entries oldest first, including those of a
+// deleted or purged product
+func (repo *GenericRepository) GetAudit(productID uint, opts ListOptions) ([]AuditEntry, int64, error) {
+	var total int64
+	query := repo.DB.Model(&AuditEntry{}).Where("product_id = ?", productID)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	entries := []AuditEntry{}
+	err := query.Order("id").Scopes(paginate(opts)).Find(&entries).Error
+	return entries, total, err
+}
+
+// Handlers
+func GetProductAudit(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	productID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+	params := NewQueryParams(r)
+	opts := ParseListOptions(params)
+	if !params.Valid() {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid query parameters", params.Errors)
+		return
+	}
+	entries, total, err := productRepo.WithContext(r.Context()).GetAudit(uint(productID), opts)
+	if err != nil {
+		http.Error(w, "Error fetching audit trail", http.StatusInternalServerError)
+		return
+	}
+	meta := newPageMeta(opts, total, len(entries))
+	respondWithPage(w, r, entries, "Audit trail retrieved successfully", meta)
+}
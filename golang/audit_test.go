@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+// auditActions lists the actions recorded against a product, oldest first
+func auditActions(t *testing.T, productID uint) []string {
+	t.Helper()
+	entries, _, err := productRepo.GetAudit(productID, ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	actions := make([]string, len(entries))
+	for i, entry := range entries {
+		actions[i] = entry.Action
+	}
+	return actions
+}
+
+func hasAction(actions []string, action string) bool {
+	for _, got := range actions {
+		if got == action {
+			return true
+		}
+	}
+	return false
+}
+
+func TestWritesOutsideProductEventsAreAudited(t *testing.T) {
+	setupTestDB(t)
+	w := serve(CreateProduct, "POST", "/products", map[string]interface{}{"name": "Widget", "sku": "W-1", "price": 5, "stock_quantity": 3}, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("create: got %d: %s", w.Code, w.Body)
+	}
+	product := decodeProduct(t, w)
+
+	w = serve(AdjustStockBatch, "POST", "/products/stock/batch", []map[string]interface{}{{"id": product.ID, "delta": 2}}, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("stock batch: got %d: %s", w.Code, w.Body)
+	}
+	w = serve(BulkTagProducts, "POST", "/products/tags/bulk", map[string]interface{}{"filter": map[string]interface{}{"q": "Widget"}, "tags": []string{"sale"}}, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("bulk tag: got %d: %s", w.Code, w.Body)
+	}
+	if err := db.Model(&Product{}).Where("id = ?", product.ID).UpdateColumn("stock_quantity", -1).Error; err != nil {
+		t.Fatal(err)
+	}
+	if w = serve(VerifyIntegrity, "POST", "/admin/verify?repair=true", nil, nil); w.Code != http.StatusOK {
+		t.Fatalf("verify: got %d: %s", w.Code, w.Body)
+	}
+
+	actions := auditActions(t, product.ID)
+	for _, action := range []string{AuditStockAdjusted, AuditTagsAdded, AuditIntegrityRepaired} {
+		if !hasAction(actions, action) {
+			t.Errorf("no %s entry in %v", action, actions)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Roles a caller may have. The admin token carries RoleAdmin; API_TOKENS
+// entries name their own.
+const (
+	RoleAdmin      = "admin"
+	RolePurchasing = "purchasing"
+)
+
+// RequireAdmin only lets requests through that carry the configured admin
+// token as a bearer token. Without ADMIN_TOKEN admin endpoints are closed.
+func RequireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(r) {
+			respondWithError(w, r, http.StatusUnauthorized, "Unauthorized", nil)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// isAdmin reports whether the request carries the admin token, for handlers
+// that only unlock some options for admins
+func isAdmin(r *http.Request) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return config.AdminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(config.AdminToken)) == 1
+}
+
+type contextKey string
+
+const (
+	userContextKey contextKey = "user"
+	roleContextKey contextKey = "role"
+)
+
+// APIToken is a "user:role:token" entry of API_TOKENS
+type APIToken struct {
+	User  string
+	Role  string
+	Token string
+}
+
+func parseAPIToken(entry string) (APIToken, error) {
+	parts := strings.SplitN(entry, ":", 3)
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return APIToken{}, fmt.Errorf("entry must look like user:role:token")
+	}
+	return APIToken{User: parts[0], Role: parts[1], Token: parts[2]}, nil
+}
+
+// tokenCaller finds the API_TOKENS entry for the request's bearer token
+func tokenCaller(r *http.Request) (APIToken, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return APIToken{}, false
+	}
+	for _, entry := range config.APITokens {
+		caller, err := parseAPIToken(entry)
+		if err == nil && subtle.ConstantTimeCompare([]byte(token), []byte(caller.Token)) == 1 {
+			return caller, true
+		}
+	}
+	return APIToken{}, false
+}
+
+// AuthenticateUser puts the id and role of the authenticated caller in the
+// request context, for auditing and field permissions. Callers are "admin"
+// with the admin token, the user of their API_TOKENS entry, or anonymous.
+func AuthenticateUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isAdmin(r) {
+			r = r.WithContext(withRole(withUser(r.Context(), "admin"), RoleAdmin))
+		} else if caller, ok := tokenCaller(r); ok {
+			r = r.WithContext(withRole(withUser(r.Context(), caller.User), caller.Role))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func withUser(ctx context.Context, userID string) context.Context {
+	if userID == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, userContextKey, userID)
+}
+
+// userFromContext returns "" for anonymous requests
+func userFromContext(ctx context.Context) string {
+	userID, _ := ctx.Value(userContextKey).(string)
+	return userID
+}
+
+func withRole(ctx context.Context, role string) context.Context {
+	return context.WithValue(ctx, roleContextKey, role)
+}
+
+// roleFromContext returns "" for anonymous requests
+func roleFromContext(ctx context.Context) string {
+	role, _ := ctx.Value(roleContextKey).(string)
+	return role
+}
+
+// restrictedField is a product field only some roles may read or change
+type restrictedField struct {
+	roles []string
+	get   func(product *Product) interface{}
+	set   func(dst, src *Product)
+}
+
+func (field restrictedField) allows(role string) bool {
+	return role != "" && slices.Contains(field.roles, role)
+}
+
+var restrictedFields = map[string]restrictedField{
+	"cost": {
+		roles: []string{RoleAdmin, RolePurchasing},
+		get:   func(product *Product) interface{} { return product.Cost },
+		set:   func(dst, src *Product) { dst.Cost = src.Cost },
+	},
+	"supplier_cost": {
+		roles: []string{RoleAdmin, RolePurchasing},
+		get:   func(product *Product) interface{} { return product.SupplierCost.Plain },
+		set:   func(dst, src *Product) { dst.SupplierCost = src.SupplierCost },
+	},
+}
+
+// checkFieldPermissions compares sent, as decoded from a request body with
+// the given top-level fields, against the stored product (nil when
+// creating). Restricted fields the caller's role can't change are carried
+// over from stored into sent when the body leaves them out, so a full update
+// doesn't reset them; one the body sets to a new value is reported. Sending
+// the stored value back is allowed, so responses can be round-tripped.
+func checkFieldPermissions(ctx context.Context, fields map[string]bool, sent, stored *Product) []string {
+	role := roleFromContext(ctx)
+	current := stored
+	if current == nil {
+		current = &Product{}
+	}
+	var errs []string
+	for name, field := range restrictedFields {
+		if field.allows(role) {
+			continue
+		}
+		if !fields[name] {
+			field.set(sent, current)
+			continue
+		}
+		if !reflect.DeepEqual(field.get(sent), field.get(current)) {
+			errs = append(errs, fmt.Sprintf("%s can only be changed by the %s roles", name, strings.Join(field.roles, " or ")))
+		}
+	}
+	sort.Strings(errs)
+	return errs
+}
+
+// marginForbidden reports, for ?include=margin, that the margin gives the
+// cost away when the request's role can't read it
+func marginForbidden(r *http.Request) []string {
+	cost := restrictedFields["cost"]
+	if cost.allows(roleFromContext(r.Context())) {
+		return nil
+	}
+	return []string{fmt.Sprintf("include=margin reveals the cost, which only the %s roles can read", strings.Join(cost.roles, " or "))}
+}
+
+// restrictedFieldPattern matches a restricted field of an encoded product
+// with its scalar value. Products start with their id, so the field always
+// follows a comma.
+var restrictedFieldPattern = func() *regexp.Regexp {
+	var names []string
+	for name := range restrictedFields {
+		names = append(names, regexp.QuoteMeta(name))
+	}
+	sort.Strings(names)
+	return regexp.MustCompile(`,\s*"(` + strings.Join(names, "|") + `)":\s*(null|"(?:[^"\\]|\\.)*"|[-+.0-9eE]+)`)
+}()
+
+// withoutRestrictedFields drops the restricted fields the request's role
+// can't read from an encoded response, leaving everything else byte for
+// byte. Only authenticated callers keep them, and defaultCacheControl never
+// lets shared caches store their responses.
+func withoutRestrictedFields(r *http.Request, body []byte) []byte {
+	role := roleFromContext(r.Context())
+	return restrictedFieldPattern.ReplaceAllFunc(body, func(match []byte) []byte {
+		name := string(restrictedFieldPattern.FindSubmatch(match)[1])
+		if restrictedFields[name].allows(role) {
+			return match
+		}
+		return nil
+	})
+}
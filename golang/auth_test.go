@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRestrictedFieldsOnlyReachAllowedRoles(t *testing.T) {
+	setupTestDB(t)
+	previous := fieldKeys
+	fieldKeys, _ = NewKeyring([]string{"test:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="}, "test")
+	t.Cleanup(func() { fieldKeys = previous })
+	cost := Price(3)
+	product := Product{Name: "Widget", SKU: "W-1", Price: 5, Cost: &cost, SupplierCost: Encrypted[float64]{Plain: 4.5}}
+	if err := db.Create(&product).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(handler http.HandlerFunc, target, role string) string {
+		r := httptest.NewRequest("GET", target, nil)
+		if role != "" {
+			r = r.WithContext(withRole(r.Context(), role))
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s as %q: got %d: %s", target, role, w.Code, w.Body)
+		}
+		return w.Body.String()
+	}
+	for _, target := range []string{"/products", "/products?pretty=true", "/products/export", "/products/export?format=json"} {
+		handler := GetAllProducts
+		if strings.HasPrefix(target, "/products/export") {
+			handler = ExportProducts
+		}
+		for _, role := range []string{"", "editor"} {
+			if body := get(handler, target, role); strings.Contains(body, "cost") {
+				t.Errorf("%s as %q leaked costs: %s", target, role, body)
+			}
+		}
+		body := get(handler, target, RolePurchasing)
+		if !strings.Contains(body, "4.5") || !strings.Contains(body, `"cost":`) {
+			t.Errorf("%s as purchasing: costs missing: %s", target, body)
+		}
+		if !strings.Contains(body, `"W-1"`) {
+			t.Errorf("%s: product mangled: %s", target, body)
+		}
+	}
+}
+
+func TestAuthenticatedRevalidatedResponsesStayPrivate(t *testing.T) {
+	for authorization, want := range map[string]string{"": "no-cache", "Bearer token": "private, no-cache"} {
+		r := httptest.NewRequest("GET", "/products/1", nil)
+		if authorization != "" {
+			r.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		notModified(w, r, time.Now())
+		if got := w.Header().Get("Cache-Control"); got != want {
+			t.Errorf("Authorization %q: got Cache-Control %q, want %q", authorization, got, want)
+		}
+	}
+}
+
+func TestComparisonAndMarginHideCostsFromOtherRoles(t *testing.T) {
+	cost := Price(3)
+	products := []Product{{ID: 1, Name: "A", Price: 5, Cost: &cost}, {ID: 2, Name: "B", Price: 6}}
+	for role, want := range map[string]bool{"": false, "editor": false, RolePurchasing: true} {
+		comparison, err := CompareProducts(products, role)
+		if err != nil {
+			t.Fatal(err)
+		}
+		compared := false
+		for _, field := range comparison.Fields {
+			if field.Field == "cost" || field.Field == "supplier_cost" {
+				compared = true
+			}
+		}
+		if compared != want {
+			t.Errorf("role %q: compared costs %v, want %v", role, compared, want)
+		}
+	}
+
+	setupTestDB(t)
+	r := httptest.NewRequest("GET", "/products?include=margin", nil)
+	w := httptest.NewRecorder()
+	GetAllProducts(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("anonymous include=margin: got %d: %s", w.Code, w.Body)
+	}
+	w = httptest.NewRecorder()
+	GetAllProducts(w, r.WithContext(withRole(r.Context(), RoleAdmin)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("admin include=margin: got %d: %s", w.Code, w.Body)
+	}
+}
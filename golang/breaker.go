@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Circuit breaker states
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open"
+)
+
+const (
+	breakerProbeKey                    = "breaker:probe"
+	breakerBypassContextKey contextKey = "breaker_bypass"
+)
+
+var ErrCircuitOpen = errors.New("database circuit breaker is open")
+
+// CircuitBreaker stops sending statements to a database that keeps failing.
+// After threshold consecutive failures it opens and rejects every statement
+// for the cooldown; then it half-opens and lets a single probe through,
+// which closes it again on success or reopens it on failure.
+type CircuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	state     string
+	failures  int
+	openedAt  time.Time
+	probing   bool
+}
+
+// dbBreaker is nil when DB_BREAKER_THRESHOLD is 0
+var dbBreaker *CircuitBreaker
+
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	if threshold <= 0 {
+		return nil
+	}
+	return &CircuitBreaker{threshold: threshold, cooldown: cooldown, state: CircuitClosed}
+}
+
+type CircuitState struct {
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	OpenedAt            *time.Time `json:"opened_at"`
+}
+
+func (b *CircuitBreaker) State() CircuitState {
+	if b == nil {
+		return CircuitState{State: CircuitClosed}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	state := CircuitState{State: b.state, ConsecutiveFailures: b.failures}
+	if b.state != CircuitClosed {
+		openedAt := b.openedAt
+		state.OpenedAt = &openedAt
+	}
+	return state
+}
+
+// allow reports whether a statement may run and whether it's the probe
+func (b *CircuitBreaker) allow() (allowed, probe bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == CircuitOpen && time.Since(b.openedAt) >= b.cooldown {
+		b.state = CircuitHalfOpen
+		log.Println("Database circuit breaker half-open, probing")
+	}
+	switch {
+	case b.state == CircuitClosed:
+		return true, false
+	case b.state == CircuitHalfOpen && !b.probing:
+		b.probing = true
+		return true, true
+	}
+	return false, false
+}
+
+// retryAfter is how long requests should wait, zero when they'd be let
+// through
+func (b *CircuitBreaker) retryAfter() time.Duration {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case CircuitOpen:
+		if remaining := b.cooldown - time.Since(b.openedAt); remaining > 0 {
+			return remaining
+		}
+	case CircuitHalfOpen:
+		if b.probing {
+			return time.Second
+		}
+	}
+	return 0
+}
+
+func (b *CircuitBreaker) record(err error, probe bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	failed := isDatabaseFailure(err)
+	if probe {
+		b.probing = false
+		if failed {
+			b.trip()
+			return
+		}
+		b.state, b.failures = CircuitClosed, 0
+		log.Println("Database circuit breaker closed")
+		return
+	}
+	// Statements still in flight when it opened don't count
+	if b.state != CircuitClosed {
+		return
+	}
+	if !failed {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.trip()
+	}
+}
+
+// trip opens the breaker; the lock must be held
+func (b *CircuitBreaker) trip() {
+	b.state = CircuitOpen
+	b.openedAt = time.Now().UTC()
+	log.Printf("Database circuit breaker opened after %d consecutive failures", b.failures)
+}
+
+// isDatabaseFailure tells errors meaning the database is unhealthy from the
+// ones a working database gives, such as missing rows or constraint
+// violations, which must not trip the breaker
+func isDatabaseFailure(err error) bool {
+	switch {
+	case err == nil,
+		errors.Is(err, gorm.ErrRecordNotFound),
+		errors.Is(err, gorm.ErrDuplicatedKey),
+		errors.Is(err, gorm.ErrForeignKeyViolated),
+		errors.Is(err, gorm.ErrCheckConstraintViolated),
+		errors.Is(err, ErrCircuitOpen),
+		errors.Is(err, context.Canceled),
+		isReadOnlyError(err):
+		return false
+	}
+	return true
+}
+
+// withoutCircuitBreaker lets a context's statements through an open breaker
+// without counting them, for health checks that must see the database
+// itself
+func withoutCircuitBreaker(ctx context.Context) context.Context {
+	return context.WithValue(ctx, breakerBypassContextKey, true)
+}
+
+// registerBreakerCallbacks guards every statement with the breaker. Row
+// statements are only counted: gorm hands back a nil *sql.Row when one is
+// rejected.
+func registerBreakerCallbacks(db *gorm.DB, breaker *CircuitBreaker) error {
+	if breaker == nil {
+		return nil
+	}
+	callbacks := db.Callback()
+	hooks := []struct {
+		before func(string, func(*gorm.DB)) error
+		after  func(string, func(*gorm.DB)) error
+		reject bool
+	}{
+		{callbacks.Create().Before("gorm:create").Register, callbacks.Create().After("gorm:create").Register, true},
+		{callbacks.Query().Before("gorm:query").Register, callbacks.Query().After("gorm:query").Register, true},
+		{callbacks.Update().Before("gorm:update").Register, callbacks.Update().After("gorm:update").Register, true},
+		{callbacks.Delete().Before("gorm:delete").Register, callbacks.Delete().After("gorm:delete").Register, true},
+		{callbacks.Row().Before("gorm:row").Register, callbacks.Row().After("gorm:row").Register, false},
+		{callbacks.Raw().Before("gorm:raw").Register, callbacks.Raw().After("gorm:raw").Register, true},
+	}
+	for _, hook := range hooks {
+		if err := hook.before("breaker:before", breakerBefore(breaker, hook.reject)); err != nil {
+			return err
+		}
+		if err := hook.after("breaker:after", breakerAfter(breaker)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func breakerBefore(breaker *CircuitBreaker, reject bool) func(*gorm.DB) {
+	return func(tx *gorm.DB) {
+		if tx.Error != nil {
+			return
+		}
+		if bypass, _ := tx.Statement.Context.Value(breakerBypassContextKey).(bool); bypass {
+			return
+		}
+		allowed, probe := breaker.allow()
+		switch {
+		case probe:
+			tx.InstanceSet(breakerProbeKey, true)
+		case !allowed && reject:
+			tx.AddError(ErrCircuitOpen)
+		}
+	}
+}
+
+func breakerAfter(breaker *CircuitBreaker) func(*gorm.DB) {
+	return func(tx *gorm.DB) {
+		if bypass, _ := tx.Statement.Context.Value(breakerBypassContextKey).(bool); bypass {
+			return
+		}
+		probe, _ := tx.InstanceGet(breakerProbeKey)
+		isProbe, _ := probe.(bool)
+		if errors.Is(tx.Error, ErrCircuitOpen) && !isProbe {
+			return
+		}
+		breaker.record(tx.Error, isProbe)
+	}
+}
+
+// Routes that answer without the database, or report on it
+var breakerExemptRoutes = map[string]bool{
+	"/livez":  true,
+	"/readyz": true,
+}
+
+// CircuitBreakerMiddleware fails requests fast with a 503 while the database
+// breaker is open, instead of letting them queue up on a dead database
+func CircuitBreakerMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wait := dbBreaker.retryAfter()
+		if wait == 0 || breakerExemptRoutes[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		respondWithError(w, r, http.StatusServiceUnavailable, "Database temporarily unavailable", nil)
+	})
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// cacheRecorder applies the default caching policy as the response starts,
+// unless the handler already set Cache-Control
+type cacheRecorder struct {
+	http.ResponseWriter
+	request *http.Request
+	started bool
+}
+
+func (rec *cacheRecorder) WriteHeader(status int) {
+	if !rec.started {
+		rec.started = true
+		header := rec.Header()
+		if header.Get("Cache-Control") == "" {
+			header.Set("Cache-Control", defaultCacheControl(rec.request, status))
+		}
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *cacheRecorder) Write(data []byte) (int, error) {
+	if !rec.started {
+		rec.WriteHeader(http.StatusOK)
+	}
+	return rec.ResponseWriter.Write(data)
+}
+
+func (rec *cacheRecorder) Flush() {
+	if flusher, ok := rec.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the connection
+func (rec *cacheRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// cacheableRoutes are the catalog reads shared caches may keep. Everything
+// else, such as health checks, job progress, stock levels and currency
+// rates, changes too often to be served stale.
+var cacheableRoutes = map[string]bool{
+	"/products":                   true,
+	"/products/by-category":       true,
+	"/products/summary":           true,
+	"/products/search":            true,
+	"/products/schema":            true,
+	"/products/facets/{field}":    true,
+	"/products/feed.xml":          true,
+	"/sitemap.xml":                true,
+	"/products/{id}":              true,
+	"/products/{id}/full":         true,
+	"/products/{id}/similar":      true,
+	"/products/{id}/tiers":        true,
+	"/products/{id}/translations": true,
+	"/categories":                 true,
+	"/categories/{id}/children":   true,
+	"/categories/{id}/ancestors":  true,
+	"/categories/{id}/products":   true,
+}
+
+// defaultCacheControl lets shared caches keep successful anonymous catalog
+// reads for CACHE_MAX_AGE. Errors, other routes and responses to
+// authenticated requests, which may hold admin-only data, are never stored.
+func defaultCacheControl(r *http.Request, status int) string {
+	if status != http.StatusOK || r.Header.Get("Authorization") != "" || !cacheableRoutes[routeTemplate(r)] {
+		return "no-store"
+	}
+	if config.CacheMaxAge <= 0 {
+		return "no-cache"
+	}
+	return fmt.Sprintf("public, max-age=%d", int(config.CacheMaxAge.Seconds()))
+}
+
+// CacheMiddleware sets Cache-Control on GET responses. Other methods are
+// left alone as caches don't store them anyway.
+func CacheMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(&cacheRecorder{ResponseWriter: w, request: r}, r)
+	})
+}
+
+// notModified makes a response cacheable with revalidation against
+// Last-Modified, and answers 304 when the client's copy is still current.
+// HTTP dates have second precision, so modified is truncated to match.
+// Responses to authenticated requests may carry restricted fields, so only
+// the client may keep those.
+func notModified(w http.ResponseWriter, r *http.Request, modified time.Time) bool {
+	modified = modified.UTC().Truncate(time.Second)
+	if r.Header.Get("Authorization") != "" {
+		w.Header().Set("Cache-Control", "private, no-cache")
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil || modified.After(since) {
+		return false
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
@@ -0,0 +1,428 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"gorm.io/gorm"
+)
+
+type Category struct {
+	ID       uint   `json:"id"`
+	Name     string `json:"name"`
+	ParentID *uint  `json:"parent_id" gorm:"index"`
+}
+
+var ErrCategoryCycle = errors.New("category cannot be its own ancestor")
+
+// Label used for products that have no category assigned
+const uncategorizedLabel = "uncategorized"
+
+// Default and maximum number of products returned per category group
+const (
+	defaultProductsPerCategory = 10
+	maxProductsPerCategory     = 50
+)
+
+// Repository for category operations
+type CategoryRepository struct {
+	DB *gorm.DB
+}
+
+func (repo *CategoryRepository) WithContext(ctx context.Context) *CategoryRepository {
+	if tx := transactionFromContext(ctx); tx != nil {
+		return &CategoryRepository{DB: tx.WithContext(ctx)}
+	}
+	return &CategoryRepository{DB: repo.DB.WithContext(ctx)}
+}
+
+func (repo *CategoryRepository) GetAll(opts ListOptions) ([]Category, int64, error) {
+	var categories []Category
+	var total int64
+	query := repo.DB.Model(&Category{}).Scopes(nameSearch(opts))
+	err := query.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	err = query.Scopes(paginate(opts)).Order("name").Find(&categories).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return categories, total, nil
+}
+
+func (repo *CategoryRepository) GetById(id uint) (*Category, error) {
+	var category Category
+	err := repo.DB.First(&category, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
+func (repo *CategoryRepository) GetChildren(id uint) ([]Category, error) {
+	var categories []Category
+	err := repo.DB.Where("parent_id = ?", id).Order("name").Find(&categories).Error
+	if err != nil {
+		return nil, err
+	}
+	return categories, nil
+}
+
+// GetAncestors returns the chain of parents of a category, root first
+func (repo *CategoryRepository) GetAncestors(id uint) ([]Category, error) {
+	var categories []Category
+	err := repo.DB.Raw(`
+		WITH RECURSIVE ancestors(id, name, parent_id, depth) AS (
+			SELECT parent.id, parent.name, parent.parent_id, 1
+			FROM categories child JOIN categories parent ON parent.id = child.parent_id
+			WHERE child.id = ?
+			UNION
+			SELECT c.id, c.name, c.parent_id, a.depth + 1
+			FROM categories c JOIN ancestors a ON c.id = a.parent_id
+		)
+		SELECT id, name, parent_id FROM ancestors ORDER BY depth DESC`, id).Scan(&categories).Error
+	if err != nil {
+		return nil, err
+	}
+	return categories, nil
+}
+
+// GetDescendantIds returns the id of the category and of everything below it.
+// UNION (rather than UNION ALL) stops the recursion even on corrupt cyclic data.
+func (repo *CategoryRepository) GetDescendantIds(id uint) ([]uint, error) {
+	var ids []uint
+	err := repo.DB.Raw(`
+		WITH RECURSIVE tree(id) AS (
+			SELECT ?
+			UNION
+			SELECT c.id FROM categories c JOIN tree t ON c.parent_id = t.id
+		)
+		SELECT id FROM tree`, id).Scan(&ids).Error
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// SetParent moves a category under another one, or to the root when parentID
+// is nil. The new parent must not be the category itself or one of its
+// descendants.
+func (repo *CategoryRepository) SetParent(category *Category, parentID *uint) (*Category, error) {
+	if parentID != nil {
+		if _, err := repo.GetById(*parentID); err != nil {
+			return nil, err
+		}
+		descendants, err := repo.GetDescendantIds(category.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range descendants {
+			if id == *parentID {
+				return nil, ErrCategoryCycle
+			}
+		}
+	}
+	err := repo.DB.Model(category).Update("parent_id", parentID).Error
+	if err != nil {
+		return nil, err
+	}
+	category.ParentID = parentID
+	return category, nil
+}
+
+func (repo *CategoryRepository) Create(category *Category) (*Category, error) {
+	err := repo.DB.Create(category).Error
+	if err != nil {
+		return nil, err
+	}
+	return category, nil
+}
+
+type categorizedProduct struct {
+	Product
+	// GroupID is the product's category, or nil when it has none or the
+	// category no longer exists
+	GroupID      *uint
+	CategoryName string
+}
+
+// GetGroupedByCategory returns the newest products of each category keyed by
+// category name. A window function caps each group in the same query, so the
+// whole map is built from a single round trip. Groups are per category id;
+// names shared by several categories, such as children of different
+// parents, are told apart by adding the id, e.g. "Tools (7)".
+func (repo *GenericRepository) GetGroupedByCategory(perCategory int) (map[string][]Product, error) {
+	var rows []categorizedProduct
+	err := repo.DB.Raw(`
+		SELECT p.*
+		FROM (
+			SELECT products.*, c.id AS group_id, c.name AS category_name,
+				ROW_NUMBER() OVER (PARTITION BY c.id ORDER BY products.id DESC) AS position
+			FROM products
+			LEFT JOIN categories c ON c.id = products.category_id
+			WHERE products.is_deleted = ?
+		) p
+		WHERE p.position <= ?
+		ORDER BY p.category_name, p.id DESC`, false, perCategory).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	names := map[uint]string{}
+	byID := map[uint][]Product{}
+	for _, row := range rows {
+		id, name := uint(0), uncategorizedLabel
+		if row.GroupID != nil {
+			id, name = *row.GroupID, row.CategoryName
+		}
+		names[id] = name
+		byID[id] = append(byID[id], row.Product)
+	}
+	categoriesNamed := map[string]int{}
+	for id := range byID {
+		categoriesNamed[names[id]]++
+	}
+	groups := make(map[string][]Product, len(byID))
+	for id, products := range byID {
+		label := names[id]
+		if categoriesNamed[label] > 1 && id != 0 {
+			label = fmt.Sprintf("%s (%d)", label, id)
+		}
+		groups[label] = products
+	}
+	return groups, nil
+}
+
+// MoveToCategory changes only the product's category. The name must still be
+// unique within the target category.
+func (repo *GenericRepository) MoveToCategory(product *Product, categoryID uint) (*Product, error) {
+	product.CategoryID = &categoryID
+	if err := repo.checkConflicts(product); err != nil {
+		return nil, err
+	}
+	err := repo.DB.Model(product).Updates(map[string]interface{}{"category_id": categoryID}).Error
+	if err != nil {
+		return nil, err
+	}
+	return product, nil
+}
+
+// Initialize repository
+var categoryRepo *CategoryRepository
+
+// Handlers
+func GetAllCategories(w http.ResponseWriter, r *http.Request) {
+	params := NewQueryParams(r)
+	opts := parseSearchListOptions(params)
+	if !params.Valid() {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid query parameters", params.Errors)
+		return
+	}
+	categories, total, err := categoryRepo.WithContext(r.Context()).GetAll(opts)
+	if err != nil {
+		http.Error(w, "Error fetching categories", http.StatusInternalServerError)
+		return
+	}
+	meta := newPageMeta(opts, total, len(categories))
+	respondWithPage(w, r, categories, "Categories retrieved successfully", meta)
+}
+
+func CreateCategory(w http.ResponseWriter, r *http.Request) {
+	var category Category
+	err := decodeBody(r, &category)
+	if err != nil || category.Name == "" {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	if category.ParentID != nil {
+		_, err := categoryRepo.WithContext(r.Context()).GetById(*category.ParentID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "Parent category not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Error creating category", http.StatusInternalServerError)
+			return
+		}
+	}
+	createdCategory, err := categoryRepo.WithContext(r.Context()).Create(&category)
+	if err != nil {
+		http.Error(w, "Error creating category", http.StatusInternalServerError)
+		return
+	}
+	response := ApiResponse{Success: true, Data: createdCategory, Message: "Category created successfully"}
+	respondWithJSON(w, r, response)
+}
+
+// categoryFromPath loads the category named by the {id} route variable,
+// writing the error response itself when that fails
+func categoryFromPath(w http.ResponseWriter, r *http.Request) (*Category, bool) {
+	categoryID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid category ID", http.StatusBadRequest)
+		return nil, false
+	}
+	category, err := categoryRepo.WithContext(r.Context()).GetById(uint(categoryID))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		http.Error(w, "Error fetching category", http.StatusInternalServerError)
+		return nil, false
+	}
+	return category, true
+}
+
+func GetCategoryChildren(w http.ResponseWriter, r *http.Request) {
+	category, ok := categoryFromPath(w, r)
+	if !ok {
+		return
+	}
+	children, err := categoryRepo.WithContext(r.Context()).GetChildren(category.ID)
+	if err != nil {
+		http.Error(w, "Error fetching categories", http.StatusInternalServerError)
+		return
+	}
+	response := ApiResponse{Success: true, Data: children, Message: "Categories retrieved successfully"}
+	respondWithJSON(w, r, response)
+}
+
+func GetCategoryAncestors(w http.ResponseWriter, r *http.Request) {
+	category, ok := categoryFromPath(w, r)
+	if !ok {
+		return
+	}
+	ancestors, err := categoryRepo.WithContext(r.Context()).GetAncestors(category.ID)
+	if err != nil {
+		http.Error(w, "Error fetching categories", http.StatusInternalServerError)
+		return
+	}
+	response := ApiResponse{Success: true, Data: ancestors, Message: "Categories retrieved successfully"}
+	respondWithJSON(w, r, response)
+}
+
+type parentRequest struct {
+	ParentID *uint `json:"parent_id"`
+}
+
+func SetCategoryParent(w http.ResponseWriter, r *http.Request) {
+	category, ok := categoryFromPath(w, r)
+	if !ok {
+		return
+	}
+	var request parentRequest
+	if err := decodeBody(r, &request); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	updatedCategory, err := categoryRepo.WithContext(r.Context()).SetParent(category, request.ParentID)
+	if errors.Is(err, ErrCategoryCycle) {
+		http.Error(w, "Category cannot be moved under itself or its descendants", http.StatusConflict)
+		return
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "Parent category not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error updating category", http.StatusInternalServerError)
+		return
+	}
+	response := ApiResponse{Success: true, Data: updatedCategory, Message: "Category updated successfully"}
+	respondWithJSON(w, r, response)
+}
+
+// GetCategoryProducts lists the products of a category, and of all its
+// descendants with ?descendants=true
+func GetCategoryProducts(w http.ResponseWriter, r *http.Request) {
+	category, ok := categoryFromPath(w, r)
+	if !ok {
+		return
+	}
+	params := NewQueryParams(r)
+	opts := parseProductListOptions(params)
+	descendants := params.Bool("descendants", false)
+	if !params.Valid() {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid query parameters", params.Errors)
+		return
+	}
+	opts.CategoryIDs = []uint{category.ID}
+	if descendants {
+		ids, err := categoryRepo.WithContext(r.Context()).GetDescendantIds(category.ID)
+		if err != nil {
+			http.Error(w, "Error fetching categories", http.StatusInternalServerError)
+			return
+		}
+		opts.CategoryIDs = ids
+	}
+	products, total, err := productRepo.WithContext(r.Context()).GetAll(opts)
+	if err != nil {
+		http.Error(w, "Error fetching products", http.StatusInternalServerError)
+		return
+	}
+	meta := newPageMeta(opts, total, len(products))
+	respondWithPage(w, r, products, "Products retrieved successfully", meta)
+}
+
+type moveRequest struct {
+	CategoryID uint `json:"category_id"`
+}
+
+func MoveProduct(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	productID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+	var request moveRequest
+	err = decodeBody(r, &request)
+	if err != nil || request.CategoryID == 0 {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	product, err := productRepo.WithContext(r.Context()).GetById(uint(productID))
+	if err != nil {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+	_, err = categoryRepo.WithContext(r.Context()).GetById(request.CategoryID)
+	if err != nil {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return
+	}
+	movedProduct, err := productRepo.WithContext(r.Context()).MoveToCategory(product, request.CategoryID)
+	if message := conflictMessage(err); message != "" {
+		http.Error(w, message, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error moving product", http.StatusInternalServerError)
+		return
+	}
+	emitEvent(r.Context(), EventProductUpdated, movedProduct)
+	response := ApiResponse{Success: true, Data: movedProduct, Message: "Product moved successfully"}
+	respondWithJSON(w, r, response)
+}
+
+func GetProductsByCategory(w http.ResponseWriter, r *http.Request) {
+	params := NewQueryParams(r)
+	perCategory := params.Int("limit", defaultProductsPerCategory, 1, maxProductsPerCategory)
+	if !params.Valid() {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid query parameters", params.Errors)
+		return
+	}
+	groups, err := productRepo.WithContext(r.Context()).GetGroupedByCategory(perCategory)
+	if err != nil {
+		http.Error(w, "Error fetching products", http.StatusInternalServerError)
+		return
+	}
+	response := ApiResponse{Success: true, Data: groups, Message: "Products retrieved successfully"}
+	respondWithJSON(w, r, response)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestCategoryListRejectsPriceFilters(t *testing.T) {
+	setupTestDB(t)
+	if w := serve(GetAllCategories, "GET", "/categories?min_price=10", nil, nil); w.Code != http.StatusBadRequest {
+		t.Fatalf("categories with min_price: got %d: %s", w.Code, w.Body)
+	}
+	if w := serve(GetAllCategories, "GET", "/categories?q=tools", nil, nil); w.Code != http.StatusOK {
+		t.Fatalf("categories: got %d: %s", w.Code, w.Body)
+	}
+	if w := serve(GetAllProducts, "GET", "/products?min_price=10&max_price=20", nil, nil); w.Code != http.StatusOK {
+		t.Fatalf("products with a price range: got %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestUnsearchableListsRejectQ(t *testing.T) {
+	setupTestDB(t)
+	for target, handler := range map[string]http.HandlerFunc{
+		"/products/recent-changes?q=widget":      GetRecentChanges,
+		"/products/issues?q=widget":              GetProductIssues,
+		"/products/reorder-suggestions?q=widget": GetReorderSuggestions,
+		"/products/deleted?q=widget":             GetDeletedProducts,
+	} {
+		if w := serve(handler, "GET", target, nil, nil); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d: %s", target, w.Code, w.Body)
+		}
+	}
+}
+
+func TestCategoryLookupsTellMissingFromFailed(t *testing.T) {
+	setupTestDB(t)
+	vars := map[string]string{"id": "9"}
+	if w := serve(GetCategoryChildren, "GET", "/categories/9/children", nil, vars); w.Code != http.StatusNotFound {
+		t.Fatalf("missing category: got %d: %s", w.Code, w.Body)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.Close()
+	if w := serve(GetCategoryChildren, "GET", "/categories/9/children", nil, vars); w.Code != http.StatusInternalServerError {
+		t.Fatalf("closed database: got %d: %s", w.Code, w.Body)
+	}
+	if w := serve(CreateCategory, "POST", "/categories", map[string]interface{}{"name": "Child", "parent_id": 9}, nil); w.Code != http.StatusInternalServerError {
+		t.Fatalf("parent lookup on a closed database: got %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestGroupedByCategoryKeepsSameNamedCategoriesApart(t *testing.T) {
+	setupTestDB(t)
+	home, garden := Category{Name: "Home"}, Category{Name: "Garden"}
+	for _, category := range []*Category{&home, &garden} {
+		if err := db.Create(category).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	homeTools := Category{Name: "Tools", ParentID: &home.ID}
+	gardenTools := Category{Name: "Tools", ParentID: &garden.ID}
+	for _, category := range []*Category{&homeTools, &gardenTools} {
+		if err := db.Create(category).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, categoryID := range []uint{homeTools.ID, homeTools.ID, gardenTools.ID, gardenTools.ID} {
+		product := Product{Name: "Product " + strconv.Itoa(i), Price: 1, CategoryID: &categoryID}
+		if err := db.Create(&product).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Create(&Product{Name: "Loose", Price: 1}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	groups, err := productRepo.GetGroupedByCategory(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{
+		"Tools (" + strconv.Itoa(int(homeTools.ID)) + ")":   2,
+		"Tools (" + strconv.Itoa(int(gardenTools.ID)) + ")": 2,
+		uncategorizedLabel: 1,
+	}
+	if len(groups) != len(want) {
+		t.Fatalf("got groups %v", groups)
+	}
+	for label, count := range want {
+		if len(groups[label]) != count {
+			t.Errorf("%s: got %d products, want %d", label, len(groups[label]), count)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Rows copied per query when cloning
+const cloneBatchSize = 500
+
+// CloneDatabase migrates the destination and copies every table into it,
+// soft-deleted products included, keeping ids. Rows already in the
+// destination are overwritten, so a clone can be refreshed by running it again.
+func CloneDatabase(source, destination *gorm.DB) (map[string]int64, error) {
+	if err := migrate(destination); err != nil {
+		return nil, err
+	}
+	copied := map[string]int64{}
+	// Parents before children, so foreign keys always resolve
+	steps := []struct {
+		table string
+		copy  func(source, destination *gorm.DB) (int64, error)
+	}{
+		{"categories", copyRows[Category]("id")},
+		{"products", copyRows[Product]("id")},
+		{"product_images", copyRows[ProductImage]("id")},
+		{"tags", copyRows[Tag]("id")},
+		{"product_tags", copyRows[ProductTag]("product_id, tag_id")},
+		{"related_products", copyRows[RelatedProduct]("product_id, related_id")},
+		{"reservations", copyRows[Reservation]("id")},
+		{"product_translations", copyRows[ProductTranslation]("id")},
+		{"audit_entries", copyRows[AuditEntry]("id")},
+		{"price_tiers", copyRows[PriceTier]("id")},
+		{"warehouse_stocks", copyRows[WarehouseStock]("product_id, warehouse_id")},
+		{"price_changes", copyRows[PriceChange]("id")},
+		{"currency_rates", copyRows[CurrencyRate]("currency")},
+		{"stock_movements", copyRows[StockMovement]("id")},
+		{"order_items", copyRows[OrderItem]("id")},
+	}
+	for _, step := range steps {
+		count, err := step.copy(source, destination)
+		if err != nil {
+			return copied, fmt.Errorf("copying %s: %w", step.table, err)
+		}
+		copied[step.table] = count
+	}
+	return copied, nil
+}
+
+// copyRows pages through a table in primary key order. Offsets rather than
+// FindInBatches, which needs a single primary key and the join tables have two.
+func copyRows[T any](order string) func(source, destination *gorm.DB) (int64, error) {
+	return func(source, destination *gorm.DB) (int64, error) {
+		var copied int64
+		for offset := 0; ; offset += cloneBatchSize {
+			var batch []T
+			err := source.Order(order).Offset(offset).Limit(cloneBatchSize).Find(&batch).Error
+			if err != nil {
+				return copied, err
+			}
+			if len(batch) == 0 {
+				return copied, nil
+			}
+			err = destination.Session(&gorm.Session{SkipHooks: true}).
+				Clauses(clause.OnConflict{UpdateAll: true}).Create(&batch).Error
+			if err != nil {
+				return copied, err
+			}
+			copied += int64(len(batch))
+		}
+	}
+}
+
+// runClone implements the -clone-to flag
+func runClone(dsn string) {
+	destination, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
+		TranslateError: true,
+		NowFunc:        utcNow,
+		Logger:         newSlogGormLogger(config.SlowQueryThreshold),
+	})
+	if err != nil {
+		log.Fatal("Error connecting to clone database: ", err)
+	}
+	copied, err := CloneDatabase(db, destination)
+	if err != nil {
+		log.Fatal("Error cloning database: ", err)
+	}
+	log.Printf("Cloned database to %s: %v", dsn, copied)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+)
+
+const maxCompareProducts = 4
+
+type FieldComparison struct {
+	Field  string        `json:"field"`
+	Same   bool          `json:"same"`
+	Values []interface{} `json:"values"`
+}
+
+type ProductComparison struct {
+	Products []Product         `json:"products"`
+	Fields   []FieldComparison `json:"fields"`
+}
+
+// CompareProducts lines up the editable fields of the products, in the order
+// given. Bookkeeping like ids and timestamps always differs, so it's left out,
+// as are the restricted fields role can't read.
+func CompareProducts(products []Product, role string) (*ProductComparison, error) {
+	documents := make([]map[string]interface{}, len(products))
+	for i, product := range products {
+		data, err := json.Marshal(product)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &documents[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	var fields []string
+	for field := range patchableFields {
+		if restricted, ok := restrictedFields[field]; ok && !restricted.allows(role) {
+			continue
+		}
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	comparison := &ProductComparison{Products: products}
+	for _, field := range fields {
+		entry := FieldComparison{Field: field, Same: true}
+		for _, document := range documents {
+			value := document[field]
+			if len(entry.Values) > 0 && !reflect.DeepEqual(entry.Values[0], value) {
+				entry.Same = false
+			}
+			entry.Values = append(entry.Values, value)
+		}
+		comparison.Fields = append(comparison.Fields, entry)
+	}
+	return comparison, nil
+}
+
+// Handlers
+func GetProductComparison(w http.ResponseWriter, r *http.Request) {
+	params := NewQueryParams(r)
+	ids := params.IDList("ids", 2, maxCompareProducts)
+	if !params.Valid() {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid query parameters", params.Errors)
+		return
+	}
+	found, err := productStore(r.Context()).GetByIds(ids)
+	if err != nil {
+		http.Error(w, "Error fetching products", http.StatusInternalServerError)
+		return
+	}
+	var products []Product
+	var missing []string
+	for _, id := range ids {
+		product, ok := found[id]
+		if !ok {
+			missing = append(missing, fmt.Sprintf("product %d not found", id))
+			continue
+		}
+		products = append(products, product)
+	}
+	if len(missing) > 0 {
+		respondWithError(w, r, http.StatusNotFound, "Products not found", missing)
+		return
+	}
+	comparison, err := CompareProducts(products, roleFromContext(r.Context()))
+	if err != nil {
+		http.Error(w, "Error comparing products", http.StatusInternalServerError)
+		return
+	}
+	response := ApiResponse{Success: true, Data: comparison, Message: "Products compared successfully"}
+	respondWithJSON(w, r, response)
+}
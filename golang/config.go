@@ -0,0 +1,352 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+type Config struct {
+	// Pretty indents every JSON response; meant for local debugging only
+	Pretty bool
+	// PriceLocale resolves ambiguous separators in string prices, e.g. "pt-BR"
+	PriceLocale string
+	// PricesAsStrings encodes prices in responses as decimal strings, "19.99"
+	PricesAsStrings bool
+	// RetentionDays before soft-deleted products are purged for good
+	RetentionDays int
+	// AdminToken guards the /admin endpoints; they are disabled when empty
+	AdminToken string
+	// APITokens are "user:role:token" credentials; the role decides which
+	// restricted fields the caller may change
+	APITokens []string
+	// WebhookURLs receive product events, comma-separated in WEBHOOK_URLS
+	WebhookURLs []string
+	// LowStockThreshold at or below which products trigger an alert
+	LowStockThreshold int
+	// SlowQueryThreshold above which queries are logged, e.g. "200ms"
+	SlowQueryThreshold time.Duration
+	// DefaultSort orders product lists without a sort parameter, e.g. "-created_at"
+	DefaultSort string
+	// StrictDecode rejects request bodies with unknown fields
+	StrictDecode bool
+	// MaxResults caps any list response, paginated or not
+	MaxResults int
+	// PaginationStyle puts list pagination in the "body", Link "headers" or "both"
+	PaginationStyle string
+	// CORSAllowedOrigins may use "*." wildcards, e.g. "https://*.shop.example.com"
+	CORSAllowedOrigins []string
+	// CORSAllowCredentials lets browsers send cookies and auth headers cross-origin
+	CORSAllowCredentials bool
+	// DBMaxOpenConns limits the connection pool
+	DBMaxOpenConns int
+	// DBConnMaxLifetime recycles pooled connections, e.g. "30m"
+	DBConnMaxLifetime time.Duration
+	// NATSURL enables publishing product events to NATS, e.g. "nats://localhost:4222"
+	NATSURL string
+	// EventSubjectPrefix is prepended to event types to form subjects
+	EventSubjectPrefix string
+	// Debug enables development aids such as ?explain=true; never set it in production
+	Debug bool
+	// ReservationTTL is how long reserved stock is held by default, e.g. "15m"
+	ReservationTTL time.Duration
+	// FieldEncryptionKeys are "id:base64key" AES keys for encrypted columns
+	FieldEncryptionKeys []string
+	// FieldEncryptionKeyID picks the key new values are encrypted with
+	FieldEncryptionKeyID string
+	// CacheMaxAge is how long shared caches may keep list responses, e.g. "30s"
+	CacheMaxAge time.Duration
+	// SaleWindowDays is how recent a price drop must be to show as a sale
+	SaleWindowDays int
+	// DefaultCurrency is the ISO 4217 code prices are stored in; exchange
+	// rates are relative to it
+	DefaultCurrency string
+	// DefaultLocale is used for translations when a request doesn't name one
+	DefaultLocale string
+	// FeatureFlags switch features on or off, e.g. "bulk_upsert=false,webhooks=true"
+	FeatureFlags map[string]bool
+	// RequestTimeout caps how long any request may take, e.g. "30s"; 0 disables it
+	RequestTimeout time.Duration
+	// DBBreakerThreshold is how many consecutive database failures open the
+	// circuit breaker; 0 disables it
+	DBBreakerThreshold int
+	// DBBreakerCooldown is how long the open breaker fails requests before
+	// probing the database again, e.g. "30s"
+	DBBreakerCooldown time.Duration
+	// RateLimit is how many requests a minute each client IP may make to a
+	// route; 0 disables rate limiting
+	RateLimit int
+	// RateLimits override it per route template, e.g. "/products/export=5"
+	RateLimits map[string]int
+}
+
+var config Config
+
+// LoadConfig reads the configuration from environment variables, falling
+// back to the optional config file at path. Values that don't parse and
+// unknown keys in the file are reported rather than silently ignored.
+func LoadConfig(path string) (Config, error) {
+	s := &settings{}
+	if path != "" {
+		file, err := readConfigFile(path)
+		if err != nil {
+			return Config{}, err
+		}
+		s.file = file
+	}
+	c := Config{
+		Pretty:               s.bool("PRETTY_JSON", false),
+		PriceLocale:          s.string("PRICE_LOCALE", ""),
+		PricesAsStrings:      s.bool("PRICES_AS_STRINGS", false),
+		RetentionDays:        s.int("RETENTION_DAYS", 90),
+		AdminToken:           s.string("ADMIN_TOKEN", ""),
+		APITokens:            s.list("API_TOKENS"),
+		WebhookURLs:          s.list("WEBHOOK_URLS"),
+		LowStockThreshold:    s.int("LOW_STOCK_THRESHOLD", 5),
+		SlowQueryThreshold:   s.duration("SLOW_QUERY_THRESHOLD", 200*time.Millisecond),
+		DefaultSort:          s.string("DEFAULT_SORT", ""),
+		StrictDecode:         s.bool("STRICT_DECODE", false),
+		MaxResults:           s.int("MAX_RESULTS", 1000),
+		PaginationStyle:      s.string("PAGINATION_STYLE", "body"),
+		CORSAllowedOrigins:   s.list("CORS_ALLOWED_ORIGINS"),
+		CORSAllowCredentials: s.bool("CORS_ALLOW_CREDENTIALS", false),
+		DBMaxOpenConns:       s.int("DB_MAX_OPEN_CONNS", 10),
+		DBConnMaxLifetime:    s.duration("DB_CONN_MAX_LIFETIME", 30*time.Minute),
+		NATSURL:              s.string("NATS_URL", ""),
+		EventSubjectPrefix:   s.string("EVENT_SUBJECT_PREFIX", "catalog"),
+		Debug:                s.bool("DEBUG", false),
+		ReservationTTL:       s.duration("RESERVATION_TTL", 15*time.Minute),
+		FieldEncryptionKeys:  s.list("FIELD_ENCRYPTION_KEYS"),
+		FieldEncryptionKeyID: s.string("FIELD_ENCRYPTION_KEY_ID", ""),
+		CacheMaxAge:          s.duration("CACHE_MAX_AGE", 30*time.Second),
+		SaleWindowDays:       s.int("SALE_WINDOW_DAYS", 30),
+		DefaultCurrency:      strings.ToUpper(s.string("DEFAULT_CURRENCY", "USD")),
+		DefaultLocale:        s.string("DEFAULT_LOCALE", "en"),
+		FeatureFlags:         s.flags("FEATURE_FLAGS"),
+		RequestTimeout:       s.duration("REQUEST_TIMEOUT", 30*time.Second),
+		DBBreakerThreshold:   s.int("DB_BREAKER_THRESHOLD", 5),
+		DBBreakerCooldown:    s.duration("DB_BREAKER_COOLDOWN", 30*time.Second),
+		RateLimit:            s.int("RATE_LIMIT", 600),
+		RateLimits:           s.limits("RATE_LIMITS"),
+	}
+	for key := range s.file {
+		if !s.read[key] {
+			s.errors = append(s.errors, fmt.Sprintf("%s: unknown setting in %s", key, path))
+		}
+	}
+	if len(s.errors) > 0 {
+		sort.Strings(s.errors)
+		return Config{}, errors.New(strings.Join(s.errors, "; "))
+	}
+	return c, nil
+}
+
+// Validate reports settings that would otherwise only fail at request time
+func (c Config) Validate() error {
+	if _, err := parseSort(c.DefaultSort, productSortFields); err != nil {
+		return fmt.Errorf("DEFAULT_SORT: %w", err)
+	}
+	if c.MaxResults < 1 {
+		return fmt.Errorf("MAX_RESULTS must be positive")
+	}
+	// Clients send string prices back as they got them, which a decimal
+	// comma locale would read "19.99" as 1999
+	if c.PricesAsStrings && c.PriceLocale != "" && usesDecimalComma(c.PriceLocale) {
+		return fmt.Errorf("PRICES_AS_STRINGS needs a PRICE_LOCALE that writes decimals with a dot")
+	}
+	if !currencyPattern.MatchString(c.DefaultCurrency) {
+		return fmt.Errorf("DEFAULT_CURRENCY must be a three-letter ISO 4217 code")
+	}
+	if normalizeLocale(c.DefaultLocale) == "" {
+		return fmt.Errorf("DEFAULT_LOCALE must be a language tag such as en or pt-BR")
+	}
+	if err := checkFeatureFlags(c.FeatureFlags); err != nil {
+		return fmt.Errorf("FEATURE_FLAGS: %w", err)
+	}
+	if c.SaleWindowDays < 1 {
+		return fmt.Errorf("SALE_WINDOW_DAYS must be positive")
+	}
+	if c.RequestTimeout < 0 {
+		return fmt.Errorf("REQUEST_TIMEOUT must not be negative")
+	}
+	if c.CacheMaxAge < 0 {
+		return fmt.Errorf("CACHE_MAX_AGE must not be negative")
+	}
+	if c.RateLimit < 0 {
+		return fmt.Errorf("RATE_LIMIT must not be negative")
+	}
+	if err := checkRateLimits(c.RateLimits); err != nil {
+		return fmt.Errorf("RATE_LIMITS: %w", err)
+	}
+	if c.DBBreakerThreshold < 0 || c.DBBreakerCooldown <= 0 {
+		return fmt.Errorf("DB_BREAKER_THRESHOLD must not be negative and DB_BREAKER_COOLDOWN must be positive")
+	}
+	if c.DBMaxOpenConns < 1 || c.DBConnMaxLifetime <= 0 {
+		return fmt.Errorf("DB_MAX_OPEN_CONNS and DB_CONN_MAX_LIFETIME must be positive")
+	}
+	for _, entry := range c.APITokens {
+		if _, err := parseAPIToken(entry); err != nil {
+			return fmt.Errorf("API_TOKENS: %w", err)
+		}
+	}
+	if c.FieldEncryptionKeyID != "" && len(c.FieldEncryptionKeys) == 0 {
+		return fmt.Errorf("FIELD_ENCRYPTION_KEY_ID is set but FIELD_ENCRYPTION_KEYS is empty")
+	}
+	if _, err := NewKeyring(c.FieldEncryptionKeys, c.FieldEncryptionKeyID); err != nil {
+		return fmt.Errorf("FIELD_ENCRYPTION_KEYS: %w", err)
+	}
+	switch c.PaginationStyle {
+	case "body", "headers", "both":
+	default:
+		return fmt.Errorf("PAGINATION_STYLE must be body, headers or both")
+	}
+	return nil
+}
+
+// readConfigFile loads a YAML or JSON file of settings named like the
+// environment variables, in either case: "retention_days: 30". Lists may be
+// YAML sequences.
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+	var raw map[string]interface{}
+	// JSON is valid YAML, so one decoder covers both
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	file := make(map[string]string, len(raw))
+	for key, value := range raw {
+		key = strings.ToUpper(key)
+		switch value := value.(type) {
+		case nil:
+		case []interface{}:
+			items := make([]string, len(value))
+			for i, item := range value {
+				items[i] = fmt.Sprint(item)
+			}
+			file[key] = strings.Join(items, ",")
+		case map[string]interface{}:
+			return nil, fmt.Errorf("%s in %s: nested settings are not supported", key, path)
+		default:
+			file[key] = fmt.Sprint(value)
+		}
+	}
+	return file, nil
+}
+
+// settings resolves each key from the environment first and the config file
+// second, collecting parse errors along the way
+type settings struct {
+	file   map[string]string
+	read   map[string]bool
+	errors []string
+}
+
+func (s *settings) lookup(key string) string {
+	if s.read == nil {
+		s.read = map[string]bool{}
+	}
+	s.read[key] = true
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return s.file[key]
+}
+
+func (s *settings) invalid(key, expected string) {
+	s.errors = append(s.errors, fmt.Sprintf("%s must be %s", key, expected))
+}
+
+func (s *settings) string(key, fallback string) string {
+	if value := s.lookup(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func (s *settings) bool(key string, fallback bool) bool {
+	raw := s.lookup(key)
+	if raw == "" {
+		return fallback
+	}
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		s.invalid(key, "true or false")
+		return fallback
+	}
+	return value
+}
+
+func (s *settings) int(key string, fallback int) int {
+	raw := s.lookup(key)
+	if raw == "" {
+		return fallback
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil {
+		s.invalid(key, "an integer")
+		return fallback
+	}
+	return value
+}
+
+func (s *settings) list(key string) []string {
+	var values []string
+	for _, value := range strings.Split(s.lookup(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// limits parses a list of name=int entries
+func (s *settings) limits(key string) map[string]int {
+	limits := map[string]int{}
+	for _, entry := range s.list(key) {
+		name, raw, _ := strings.Cut(entry, "=")
+		value, err := strconv.Atoi(strings.TrimSpace(raw))
+		if err != nil {
+			s.invalid(key, "a list of name=integer entries")
+			return limits
+		}
+		limits[strings.TrimSpace(name)] = value
+	}
+	return limits
+}
+
+// flags parses a list of name=bool entries
+func (s *settings) flags(key string) map[string]bool {
+	flags := map[string]bool{}
+	for _, entry := range s.list(key) {
+		name, raw, _ := strings.Cut(entry, "=")
+		value, err := strconv.ParseBool(strings.TrimSpace(raw))
+		if err != nil {
+			s.invalid(key, "a list of name=true or name=false")
+			return flags
+		}
+		flags[strings.TrimSpace(name)] = value
+	}
+	return flags
+}
+
+func (s *settings) duration(key string, fallback time.Duration) time.Duration {
+	raw := s.lookup(key)
+	if raw == "" {
+		return fallback
+	}
+	value, err := time.ParseDuration(raw)
+	if err != nil {
+		s.invalid(key, `a duration such as "30s"`)
+		return fallback
+	}
+	return value
+}
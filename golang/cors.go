@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+const (
+	corsAllowMethods = "GET, POST, PUT, PATCH, DELETE, OPTIONS"
+	corsMaxAge       = "600"
+)
+
+// matchOrigin reports whether an origin such as "https://a.shop.example.com"
+// is allowed. Patterns are full origins, "*" for any origin, or carry a
+// "*." wildcard that matches one or more subdomain levels but not the bare
+// domain: "https://*.shop.example.com" allows "https://a.shop.example.com".
+func matchOrigin(origin string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if pattern == "*" || strings.EqualFold(pattern, origin) {
+			return true
+		}
+		index := strings.Index(pattern, "*.")
+		if index < 0 {
+			continue
+		}
+		prefix, suffix := strings.ToLower(pattern[:index]), strings.ToLower(pattern[index+1:])
+		lower := strings.ToLower(origin)
+		if !strings.HasPrefix(lower, prefix) || !strings.HasSuffix(lower, suffix) || len(lower) <= len(prefix)+len(suffix) {
+			continue
+		}
+		// The wildcard only stands for host labels
+		if subdomain := lower[len(prefix) : len(lower)-len(suffix)]; !strings.ContainsAny(subdomain, "/:@") {
+			return true
+		}
+	}
+	return false
+}
+
+// CORSMiddleware answers preflight requests and adds the CORS headers for
+// origins in CORS_ALLOWED_ORIGINS. The matched origin is echoed back rather
+// than "*", which browsers refuse when credentials are allowed. Other
+// origins get no CORS headers, so the browser blocks the response.
+// It wraps the router: preflights must be answered before route matching,
+// which would reject OPTIONS with a 405.
+func CORSMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Origin")
+		allowed := matchOrigin(origin, config.CORSAllowedOrigins)
+		if allowed {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			if config.CORSAllowCredentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+		}
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			if allowed {
+				w.Header().Set("Access-Control-Allow-Methods", corsAllowMethods)
+				if headers := r.Header.Get("Access-Control-Request-Headers"); headers != "" {
+					w.Header().Set("Access-Control-Allow-Headers", headers)
+				}
+				w.Header().Set("Access-Control-Max-Age", corsMaxAge)
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
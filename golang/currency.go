@@ -0,0 +1,127 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm/clause"
+)
+
+// Most currencies one request can convert to
+const maxCurrencies = 20
+
+var currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// CurrencyRate is how many units of Currency one unit of the default
+// currency buys
+type CurrencyRate struct {
+	Currency  string    `json:"currency" gorm:"primaryKey"`
+	Rate      float64   `json:"rate"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// CurrencyPrices is returned with a product for ?currencies=
+type CurrencyPrices struct {
+	Currency string           `json:"currency"`
+	Prices   map[string]Price `json:"prices"`
+}
+
+func (repo *GenericRepository) GetRates() ([]CurrencyRate, error) {
+	rates := []CurrencyRate{}
+	err := repo.DB.Order("currency").Find(&rates).Error
+	return rates, err
+}
+
+func (repo *GenericRepository) SaveRate(rate *CurrencyRate) error {
+	rate.UpdatedAt = time.Now().UTC()
+	return repo.DB.Clauses(clause.OnConflict{UpdateAll: true}).Create(rate).Error
+}
+
+// ConvertPrice prices an amount of the default currency in each currency.
+// Codes that are malformed or have no rate are skipped with a warning.
+func (repo *GenericRepository) ConvertPrice(price Price, currencies []string) (*CurrencyPrices, []string, error) {
+	converted := &CurrencyPrices{Currency: config.DefaultCurrency, Prices: map[string]Price{}}
+	var warnings, known []string
+	for _, currency := range currencies {
+		if !currencyPattern.MatchString(currency) {
+			warnings = append(warnings, "skipped invalid currency code "+currency)
+			continue
+		}
+		known = append(known, currency)
+	}
+	var rates []CurrencyRate
+	if err := repo.DB.Where("currency IN ?", known).Find(&rates).Error; err != nil {
+		return nil, nil, err
+	}
+	byCurrency := map[string]float64{config.DefaultCurrency: 1}
+	for _, rate := range rates {
+		byCurrency[rate.Currency] = rate.Rate
+	}
+	for _, currency := range known {
+		rate, ok := byCurrency[currency]
+		if !ok {
+			warnings = append(warnings, "skipped currency "+currency+" without an exchange rate")
+			continue
+		}
+		converted.Prices[currency] = Price(math.Round(float64(price)*rate*100) / 100)
+	}
+	return converted, warnings, nil
+}
+
+// requestCurrencies lists the upper-cased codes of ?currencies=USD,EUR,BRL
+func requestCurrencies(params *QueryParams) []string {
+	var currencies []string
+	seen := map[string]bool{}
+	for _, raw := range strings.Split(params.values.Get("currencies"), ",") {
+		currency := strings.ToUpper(strings.TrimSpace(raw))
+		if currency != "" && !seen[currency] {
+			seen[currency] = true
+			currencies = append(currencies, currency)
+		}
+	}
+	if len(currencies) > maxCurrencies {
+		params.addError("currencies must list at most %d codes", maxCurrencies)
+		return nil
+	}
+	return currencies
+}
+
+// Handlers
+func GetCurrencyRates(w http.ResponseWriter, r *http.Request) {
+	rates, err := productRepo.WithContext(r.Context()).GetRates()
+	if err != nil {
+		http.Error(w, "Error fetching exchange rates", http.StatusInternalServerError)
+		return
+	}
+	response := ApiResponse{Success: true, Data: rates, Message: "Exchange rates retrieved successfully"}
+	respondWithJSON(w, r, response)
+}
+
+func PutCurrencyRate(w http.ResponseWriter, r *http.Request) {
+	currency := strings.ToUpper(mux.Vars(r)["currency"])
+	if !currencyPattern.MatchString(currency) || currency == config.DefaultCurrency {
+		http.Error(w, "Invalid currency code", http.StatusBadRequest)
+		return
+	}
+	var rate CurrencyRate
+	if err := decodeBody(r, &rate); err != nil {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid input", []string{err.Error()})
+		return
+	}
+	if rate.Rate <= 0 || math.IsInf(rate.Rate, 0) {
+		respondWithError(w, r, http.StatusUnprocessableEntity, "Invalid exchange rate", []string{"rate must be positive"})
+		return
+	}
+	rate.Currency = currency
+	if err := productRepo.WithContext(r.Context()).SaveRate(&rate); err != nil {
+		http.Error(w, "Error saving exchange rate", http.StatusInternalServerError)
+		return
+	}
+	auditChanges(r.Context(), []uint{0}, AuditCurrencyRateSaved, rate)
+	response := ApiResponse{Success: true, Data: rate, Message: "Exchange rate saved successfully"}
+	respondWithJSON(w, r, response)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// How often the connection watchdog pings the database
+	dbPingInterval = 30 * time.Second
+	dbPingTimeout  = 5 * time.Second
+)
+
+// configurePool makes the pool recover from a dropped database on its own.
+// database/sql already retries a query on a fresh connection when the
+// driver reports one as broken; capping lifetime and idle time also retires
+// connections that were left dangling by a database restart before they
+// are ever handed out.
+func configurePool(sqlDB *sql.DB) {
+	sqlDB.SetMaxOpenConns(config.DBMaxOpenConns)
+	sqlDB.SetMaxIdleConns(config.DBMaxOpenConns)
+	sqlDB.SetConnMaxLifetime(config.DBConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(config.DBConnMaxLifetime / 2)
+}
+
+// dbWatchdog remembers whether the last ping succeeded, so only changes
+// are logged
+type dbWatchdog struct {
+	sqlDB   *sql.DB
+	healthy bool
+}
+
+// ping checks the database once and reports whether it answered
+func (w *dbWatchdog) ping(ctx context.Context) bool {
+	pingCtx, cancel := context.WithTimeout(ctx, dbPingTimeout)
+	err := w.sqlDB.PingContext(pingCtx)
+	cancel()
+	switch {
+	case err != nil && w.healthy:
+		log.Println("Database connection lost: ", err)
+	case err == nil && !w.healthy:
+		log.Println("Database connection restored")
+	}
+	w.healthy = err == nil
+	return w.healthy
+}
+
+// StartDBWatchdog pings the database until ctx is cancelled. A failed ping
+// makes the pool drop the bad connection and dial a new one on the next
+// attempt, so the watchdog mostly makes outages visible in the logs.
+func StartDBWatchdog(ctx context.Context, wg *sync.WaitGroup, sqlDB *sql.DB) {
+	watchdog := &dbWatchdog{sqlDB: sqlDB, healthy: true}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(dbPingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			watchdog.ping(ctx)
+		}
+	}()
+}
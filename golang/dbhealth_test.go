@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"testing"
+)
+
+// closePooledConnection closes a connection's driver connection behind the
+// pool's back, as a database restart does, and hands it back to the pool
+func closePooledConnection(t *testing.T, sqlDB *sql.DB) {
+	t.Helper()
+	conn, err := sqlDB.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = conn.Raw(func(driverConn interface{}) error {
+		return driverConn.(io.Closer).Close()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+}
+
+func databaseReady(ctx context.Context) (bool, string) {
+	for _, check := range CheckReadiness(ctx) {
+		if check.Name == "database" {
+			return check.OK, check.Error
+		}
+	}
+	return false, "no database check"
+}
+
+func TestDBWatchdogRecoversFromClosedConnection(t *testing.T) {
+	database := setupTestDB(t)
+	sqlDB, err := database.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	configurePool(sqlDB)
+	ctx := context.Background()
+	watchdog := &dbWatchdog{sqlDB: sqlDB, healthy: true}
+
+	closePooledConnection(t, sqlDB)
+	if watchdog.ping(ctx) {
+		t.Fatal("watchdog: ping on a closed connection succeeded")
+	}
+	if !watchdog.ping(ctx) {
+		t.Fatal("watchdog: pool didn't replace the closed connection")
+	}
+
+	closePooledConnection(t, sqlDB)
+	if ok, _ := databaseReady(ctx); ok {
+		t.Fatal("readiness: ready on a closed connection")
+	}
+	if ok, message := databaseReady(ctx); !ok {
+		t.Fatalf("readiness: still failing after the pool recovered: %s", message)
+	}
+	if _, _, err := productRepo.WithContext(ctx).GetAll(ListOptions{}); err != nil {
+		t.Fatalf("queries after recovery: %v", err)
+	}
+}
+
+func TestDBWatchdogReportsClosedDatabase(t *testing.T) {
+	database := setupTestDB(t)
+	sqlDB, err := database.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.Close()
+	ctx := context.Background()
+
+	watchdog := &dbWatchdog{sqlDB: sqlDB, healthy: true}
+	if watchdog.ping(ctx) || watchdog.healthy {
+		t.Fatal("watchdog: closed database reported healthy")
+	}
+	ok, message := databaseReady(ctx)
+	if ok {
+		t.Fatal("readiness: ready on a closed database")
+	}
+	if message != "sql: database is closed" {
+		t.Fatalf("readiness: unexpected error %q", message)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Deprecation announces that an endpoint, or one of its query parameters,
+// is going away
+type Deprecation struct {
+	// Method and Route (a path template such as "/products/{id}") select the
+	// endpoint; an empty Method matches any
+	Method string
+	Route  string
+	// Param deprecates a single query parameter instead of the endpoint
+	Param string
+	Since time.Time
+	// Sunset is when it will be removed; zero while no date is set
+	Sunset time.Time
+	// Message points clients to the replacement
+	Message string
+}
+
+// deprecations is the registry the middleware checks every request against.
+// Entries are added here when something is deprecated, e.g.
+//
+//	{Route: "/products", Param: "old", Since: time.Date(...), Message: "use new instead"}
+var deprecations []Deprecation
+
+const deprecationContextKey contextKey = "deprecations"
+
+func (d Deprecation) matches(r *http.Request, route string) bool {
+	if d.Route != route || (d.Method != "" && d.Method != r.Method) {
+		return false
+	}
+	return d.Param == "" || r.URL.Query().Has(d.Param)
+}
+
+func (d Deprecation) warning(r *http.Request) string {
+	warning := fmt.Sprintf("%s %s is deprecated", r.Method, d.Route)
+	if d.Param != "" {
+		warning = fmt.Sprintf("query parameter %s is deprecated", d.Param)
+	}
+	if !d.Sunset.IsZero() {
+		warning += " and will be removed on " + d.Sunset.UTC().Format("2006-01-02")
+	}
+	if d.Message != "" {
+		warning += ": " + d.Message
+	}
+	return warning
+}
+
+// DeprecationMiddleware sets the Deprecation (RFC 9745) and Sunset
+// (RFC 8594) headers when a request uses anything deprecated, and leaves a
+// warning for the response body. With several matches the earliest dates win.
+func DeprecationMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := ""
+		if current := mux.CurrentRoute(r); current != nil {
+			route, _ = current.GetPathTemplate()
+		}
+		var since, sunset time.Time
+		var warnings []string
+		for _, deprecation := range deprecations {
+			if !deprecation.matches(r, route) {
+				continue
+			}
+			warnings = append(warnings, deprecation.warning(r))
+			if since.IsZero() || deprecation.Since.Before(since) {
+				since = deprecation.Since
+			}
+			if !deprecation.Sunset.IsZero() && (sunset.IsZero() || deprecation.Sunset.Before(sunset)) {
+				sunset = deprecation.Sunset
+			}
+		}
+		if len(warnings) > 0 {
+			w.Header().Set("Deprecation", "@"+strconv.FormatInt(since.Unix(), 10))
+			if !sunset.IsZero() {
+				w.Header().Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+			}
+			r = r.WithContext(context.WithValue(r.Context(), deprecationContextKey, warnings))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// deprecationWarnings returns the warnings DeprecationMiddleware left for r
+func deprecationWarnings(r *http.Request) []string {
+	warnings, _ := r.Context().Value(deprecationContextKey).([]string)
+	return warnings
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+type ProductImage struct {
+	ID        uint   `json:"id"`
+	ProductID uint   `json:"product_id" gorm:"index"`
+	URL       string `json:"url"`
+	Position  int    `json:"position"`
+}
+
+type Tag struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name" gorm:"uniqueIndex"`
+}
+
+// Join tables, migrated explicitly so they get composite primary keys
+type ProductTag struct {
+	ProductID uint `gorm:"primaryKey"`
+	TagID     uint `gorm:"primaryKey;index"`
+}
+
+type RelatedProduct struct {
+	ProductID uint `gorm:"primaryKey"`
+	RelatedID uint `gorm:"primaryKey"`
+}
+
+// ProductDetails is a read model of a product with its associations. They
+// live here rather than on Product so regular writes never cascade into them.
+type ProductDetails struct {
+	Product
+	Category *Category      `json:"category"`
+	Images   []ProductImage `json:"images" gorm:"foreignKey:ProductID"`
+	Tags     []Tag          `json:"tags" gorm:"many2many:product_tags;joinForeignKey:ProductID;joinReferences:TagID"`
+	Related  []Product      `json:"related" gorm:"many2many:related_products;joinForeignKey:ProductID;joinReferences:RelatedID"`
+}
+
+func (ProductDetails) TableName() string {
+	return "products"
+}
+
+// Associations by their JSON name, as accepted by ?expand=
+var productAssociations = map[string]func(*gorm.DB) *gorm.DB{
+	"category": func(db *gorm.DB) *gorm.DB { return db.Preload("Category") },
+	"images": func(db *gorm.DB) *gorm.DB {
+		return db.Preload("Images", func(db *gorm.DB) *gorm.DB { return db.Order("position, id") })
+	},
+	"tags": func(db *gorm.DB) *gorm.DB {
+		return db.Preload("Tags", func(db *gorm.DB) *gorm.DB { return db.Order("name") })
+	},
+	"related": func(db *gorm.DB) *gorm.DB { return db.Preload("Related", "is_deleted = ?", false) },
+}
+
+func (repo *GenericRepository) GetDetails(id uint) (*ProductDetails, error) {
+	var all []string
+	for name := range productAssociations {
+		all = append(all, name)
+	}
+	return repo.GetExpanded(id, all)
+}
+
+// GetExpanded loads a product with only the named associations; unknown
+// names are ignored
+func (repo *GenericRepository) GetExpanded(id uint, expand []string) (*ProductDetails, error) {
+	var details ProductDetails
+	query := repo.DB
+	for _, name := range expand {
+		if preload, ok := productAssociations[name]; ok {
+			query = preload(query)
+		}
+	}
+	err := query.Where("id = ? AND is_deleted = ?", id, false).First(&details).Error
+	if err != nil {
+		return nil, err
+	}
+	// Empty associations are returned as [] rather than null
+	if details.Images == nil {
+		details.Images = []ProductImage{}
+	}
+	if details.Tags == nil {
+		details.Tags = []Tag{}
+	}
+	if details.Related == nil {
+		details.Related = []Product{}
+	}
+	return &details, nil
+}
+
+// Handlers
+func GetProductDetails(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	productID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+	details, err := productRepo.WithContext(r.Context()).GetDetails(uint(productID))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error fetching product", http.StatusInternalServerError)
+		return
+	}
+	if err := localize(w, r, append([]*Product{&details.Product}, productPointers(details.Related)...)...); err != nil {
+		http.Error(w, "Error fetching product", http.StatusInternalServerError)
+		return
+	}
+	response := ApiResponse{Success: true, Data: details, Message: "Product retrieved successfully"}
+	respondWithJSON(w, r, response)
+}
+
+func getExpandedProduct(w http.ResponseWriter, r *http.Request, id uint, raw string) {
+	expand := strings.Split(raw, ",")
+	for i := range expand {
+		expand[i] = strings.TrimSpace(expand[i])
+	}
+	details, err := productRepo.WithContext(r.Context()).GetExpanded(id, expand)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error fetching product", http.StatusInternalServerError)
+		return
+	}
+	if err := localize(w, r, append([]*Product{&details.Product}, productPointers(details.Related)...)...); err != nil {
+		http.Error(w, "Error fetching product", http.StatusInternalServerError)
+		return
+	}
+	document, err := expandedProduct(details, expand)
+	if err != nil {
+		http.Error(w, "Error fetching product", http.StatusInternalServerError)
+		return
+	}
+	response := ApiResponse{Success: true, Data: document, Message: "Product retrieved successfully"}
+	respondWithJSON(w, r, response)
+}
+
+// expandedProduct renders a product with only the expanded associations,
+// so the ones not asked for are left out rather than shown empty
+func expandedProduct(details *ProductDetails, expand []string) (map[string]interface{}, error) {
+	data, err := json.Marshal(details)
+	if err != nil {
+		return nil, err
+	}
+	var document map[string]interface{}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+	keep := map[string]bool{}
+	for _, name := range expand {
+		keep[name] = true
+	}
+	for name := range productAssociations {
+		if !keep[name] {
+			delete(document, name)
+		}
+	}
+	return document, nil
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Keys products can be grouped by to find duplicates
+var duplicateKeys = map[string]string{
+	"name": "LOWER(TRIM(name))",
+	"sku":  "sku",
+}
+
+type DuplicateGroup struct {
+	Key      string    `json:"key"`
+	Products []Product `json:"products"`
+}
+
+// GetDuplicates groups the active products sharing a key, names compared
+// trimmed and ignoring case. Only groups with more than one member are
+// returned, largest first.
+func (repo *GenericRepository) GetDuplicates(by string) ([]DuplicateGroup, error) {
+	expression := duplicateKeys[by]
+	var keys []string
+	err := repo.DB.Model(&Product{}).
+		Select(expression).
+		Where("is_deleted = ?", false).
+		Where(expression+" <> ''").
+		Group(expression).
+		Having("COUNT(*) > 1").
+		Order("COUNT(*) DESC, "+expression).
+		Limit(config.MaxResults).
+		Pluck(expression, &keys).Error
+	if err != nil {
+		return nil, err
+	}
+	groups := make([]DuplicateGroup, 0, len(keys))
+	if len(keys) == 0 {
+		return groups, nil
+	}
+
+	// The key is selected rather than recomputed in Go, so grouping uses the
+	// database's own LOWER and TRIM
+	var rows []struct {
+		Product
+		DuplicateKey string
+	}
+	err = repo.DB.Model(&Product{}).
+		Select("*, "+expression+" AS duplicate_key").
+		Where("is_deleted = ?", false).
+		Where(expression+" IN ?", keys).
+		Order("id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	index := make(map[string]int, len(keys))
+	for i, key := range keys {
+		index[key] = i
+		groups = append(groups, DuplicateGroup{Key: key})
+	}
+	for _, row := range rows {
+		if i, ok := index[row.DuplicateKey]; ok {
+			groups[i].Products = append(groups[i].Products, row.Product)
+		}
+	}
+	return groups, nil
+}
+
+// Handlers
+func GetDuplicateProducts(w http.ResponseWriter, r *http.Request) {
+	by := r.URL.Query().Get("by")
+	if by == "" {
+		by = "name"
+	}
+	if _, ok := duplicateKeys[by]; !ok {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid query parameters", []string{"by must be name or sku"})
+		return
+	}
+	groups, err := productRepo.WithContext(r.Context()).GetDuplicates(by)
+	if err != nil {
+		http.Error(w, "Error finding duplicates", http.StatusInternalServerError)
+		return
+	}
+	response := ApiResponse{Success: true, Data: groups, Message: "Duplicates retrieved successfully"}
+	respondWithJSON(w, r, response)
+}
+
+const maxMergeProducts = 50
+
+var ErrMergeSurvivor = errors.New("survivor cannot be merged into itself")
+
+// Merge folds the products in ids into the survivor: their images, tags,
+// relations, reservations, translations and price tiers move over, stock and
+// views are summed, per warehouse too, and the merged products are
+// soft-deleted, all in one transaction. Where the survivor already has a
+// translation for a locale or a tier for a quantity, the survivor's is kept.
+func (repo *GenericRepository) Merge(survivorID uint, ids []uint) error {
+	for _, id := range ids {
+		if id == survivorID {
+			return ErrMergeSurvivor
+		}
+	}
+	ids = uniqueIDs(ids)
+	return repo.DB.Transaction(func(tx *gorm.DB) error {
+		var survivor Product
+		if err := tx.Where("id = ? AND is_deleted = ?", survivorID, false).First(&survivor).Error; err != nil {
+			return err
+		}
+		var merged []Product
+		if err := tx.Where("id IN ? AND is_deleted = ?", ids, false).Find(&merged).Error; err != nil {
+			return err
+		}
+		if len(merged) != len(ids) {
+			return gorm.ErrRecordNotFound
+		}
+
+		previousStock := survivor.StockQuantity
+		stock, views := survivor.StockQuantity, survivor.ViewCount
+		for _, product := range merged {
+			stock += product.StockQuantity
+			views += product.ViewCount
+		}
+		err := tx.Model(&survivor).UpdateColumns(map[string]interface{}{
+			"stock_quantity": stock,
+			"view_count":     views,
+			"updated_at":     time.Now().UTC(),
+		}).Error
+		if err != nil {
+			return err
+		}
+		if stock != previousStock {
+			movement := StockMovement{
+				ProductID: survivorID,
+				Delta:     stock - previousStock,
+				Reason:    "products merged",
+				Quantity:  stock,
+			}
+			if err := tx.Create(&movement).Error; err != nil {
+				return err
+			}
+		}
+
+		for _, model := range []interface{}{&ProductImage{}, &Reservation{}} {
+			if err := tx.Model(model).Where("product_id IN ?", ids).Update("product_id", survivorID).Error; err != nil {
+				return err
+			}
+		}
+
+		var stocks []WarehouseStock
+		if err := tx.Where("product_id IN ?", ids).Find(&stocks).Error; err != nil {
+			return err
+		}
+		for _, stock := range stocks {
+			err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "product_id"}, {Name: "warehouse_id"}},
+				DoUpdates: clause.Assignments(map[string]interface{}{"quantity": gorm.Expr("warehouse_stocks.quantity + ?", stock.Quantity)}),
+			}).Create(&WarehouseStock{ProductID: survivorID, WarehouseID: stock.WarehouseID, Quantity: stock.Quantity}).Error
+			if err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("product_id IN ?", ids).Delete(&WarehouseStock{}).Error; err != nil {
+			return err
+		}
+
+		// One product at a time, so two merged products with the same locale
+		// or quantity don't both move
+		for _, id := range ids {
+			err := tx.Model(&ProductTranslation{}).
+				Where("product_id = ? AND locale NOT IN (?)", id, tx.Model(&ProductTranslation{}).Select("locale").Where("product_id = ?", survivorID)).
+				Update("product_id", survivorID).Error
+			if err != nil {
+				return err
+			}
+			err = tx.Model(&PriceTier{}).
+				Where("product_id = ? AND min_quantity NOT IN (?)", id, tx.Model(&PriceTier{}).Select("min_quantity").Where("product_id = ?", survivorID)).
+				Update("product_id", survivorID).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		// Join rows can't just be re-pointed: the survivor may already have
+		// the tag or relation, so they're copied ignoring duplicates
+		var tags []ProductTag
+		if err := tx.Where("product_id IN ?", ids).Find(&tags).Error; err != nil {
+			return err
+		}
+		for i := range tags {
+			tags[i].ProductID = survivorID
+		}
+		var relations []RelatedProduct
+		if err := tx.Where("product_id IN ? OR related_id IN ?", ids, ids).Find(&relations).Error; err != nil {
+			return err
+		}
+		mergedIDs := make(map[uint]bool, len(ids))
+		for _, id := range ids {
+			mergedIDs[id] = true
+		}
+		var moved []RelatedProduct
+		for _, relation := range relations {
+			if mergedIDs[relation.ProductID] {
+				relation.ProductID = survivorID
+			}
+			if mergedIDs[relation.RelatedID] {
+				relation.RelatedID = survivorID
+			}
+			if relation.ProductID != relation.RelatedID {
+				moved = append(moved, relation)
+			}
+		}
+		if err := tx.Where("product_id IN ?", ids).Delete(&ProductTag{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("product_id IN ? OR related_id IN ?", ids, ids).Delete(&RelatedProduct{}).Error; err != nil {
+			return err
+		}
+		if len(tags) > 0 {
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&tags).Error; err != nil {
+				return err
+			}
+		}
+		if len(moved) > 0 {
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&moved).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Model(&Product{}).Where("id IN ?", ids).UpdateColumns(map[string]interface{}{
+			"is_deleted":     true,
+			"deleted_at":     time.Now().UTC(),
+			"deleted_reason": fmt.Sprintf("merged into product %d", survivorID),
+		}).Error
+	})
+}
+
+type mergeRequest struct {
+	SurvivorID uint   `json:"survivor_id"`
+	MergeIDs   []uint `json:"merge_ids"`
+}
+
+func MergeProducts(w http.ResponseWriter, r *http.Request) {
+	var request mergeRequest
+	if err := decodeBody(r, &request); err != nil {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid input", []string{err.Error()})
+		return
+	}
+	if request.SurvivorID == 0 || len(request.MergeIDs) == 0 || len(request.MergeIDs) > maxMergeProducts {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid input", []string{fmt.Sprintf("survivor_id and between 1 and %d merge_ids are required", maxMergeProducts)})
+		return
+	}
+	repo := productRepo.WithContext(r.Context())
+	err := repo.Merge(request.SurvivorID, request.MergeIDs)
+	if errors.Is(err, ErrMergeSurvivor) {
+		respondWithError(w, r, http.StatusUnprocessableEntity, "Invalid merge", []string{err.Error()})
+		return
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error merging products", http.StatusInternalServerError)
+		return
+	}
+	details, err := repo.GetDetails(request.SurvivorID)
+	if err != nil {
+		http.Error(w, "Error fetching merged product", http.StatusInternalServerError)
+		return
+	}
+	emitEvent(r.Context(), EventProductUpdated, &details.Product)
+	for _, id := range uniqueIDs(request.MergeIDs) {
+		emitEvent(r.Context(), EventProductDeleted, map[string]uint{"id": id})
+	}
+	response := ApiResponse{Success: true, Data: details, Message: "Products merged successfully"}
+	respondWithJSON(w, r, response)
+}
+
+func uniqueIDs(ids []uint) []uint {
+	seen := make(map[uint]bool, len(ids))
+	unique := ids[:0:0]
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Keyring holds the AES-GCM keys for field encryption. Values are encrypted
+// with the current key and record its id, so older keys keep decrypting
+// after a rotation until the rows are re-encrypted.
+type Keyring struct {
+	current string
+	keys    map[string]cipher.AEAD
+}
+
+// fieldKeys is nil when FIELD_ENCRYPTION_KEYS is unset
+var fieldKeys *Keyring
+
+var ErrEncryptionDisabled = errors.New("field encryption is not configured")
+
+const encryptedPrefix = "v1:"
+
+// NewKeyring parses "id:base64key" entries; keys must be 16, 24 or 32 bytes.
+// current may be empty when there's a single key.
+func NewKeyring(specs []string, current string) (*Keyring, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	keyring := &Keyring{current: current, keys: map[string]cipher.AEAD{}}
+	for _, spec := range specs {
+		id, encoded, ok := strings.Cut(spec, ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("key %q must look like id:base64key", spec)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("key %s is not valid base64", id)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", id, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		keyring.keys[id] = aead
+	}
+	if keyring.current == "" && len(specs) == 1 {
+		keyring.current, _, _ = strings.Cut(specs[0], ":")
+	}
+	if _, ok := keyring.keys[keyring.current]; !ok {
+		return nil, fmt.Errorf("current key %q is not in the keyring", keyring.current)
+	}
+	return keyring, nil
+}
+
+// Encrypt returns "v1:<key id>:<base64 nonce and ciphertext>"
+func (k *Keyring) Encrypt(plaintext []byte) (string, error) {
+	if k == nil {
+		return "", ErrEncryptionDisabled
+	}
+	aead := k.keys[k.current]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, plaintext, nil)
+	return encryptedPrefix + k.current + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (k *Keyring) Decrypt(value string) ([]byte, error) {
+	if k == nil {
+		return nil, ErrEncryptionDisabled
+	}
+	id, encoded, ok := strings.Cut(strings.TrimPrefix(value, encryptedPrefix), ":")
+	if !ok || !strings.HasPrefix(value, encryptedPrefix) {
+		return nil, errors.New("value is not encrypted")
+	}
+	aead, ok := k.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown encryption key %q", id)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return nil, errors.New("malformed encrypted value")
+	}
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+}
+
+// Encrypted is a column stored encrypted with fieldKeys. It reads and writes
+// as a plain T in JSON, so handlers never see ciphertext. Zero values are
+// stored as NULL.
+type Encrypted[T any] struct {
+	Plain T
+}
+
+func (e Encrypted[T]) IsZero() bool {
+	return reflect.ValueOf(&e.Plain).Elem().IsZero()
+}
+
+func (e Encrypted[T]) MarshalJSON() ([]byte, error) {
+	return json.Marshal(e.Plain)
+}
+
+func (e *Encrypted[T]) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, &e.Plain)
+}
+
+// plainType is T, which is what the JSON schema describes
+func (Encrypted[T]) plainType() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
+
+func (Encrypted[T]) GormDataType() string {
+	return "text"
+}
+
+func (e Encrypted[T]) Value() (driver.Value, error) {
+	if e.IsZero() {
+		return nil, nil
+	}
+	plaintext, err := json.Marshal(e.Plain)
+	if err != nil {
+		return nil, err
+	}
+	return fieldKeys.Encrypt(plaintext)
+}
+
+func (e *Encrypted[T]) Scan(src interface{}) error {
+	var zero T
+	e.Plain = zero
+	var stored string
+	switch value := src.(type) {
+	case nil:
+		return nil
+	case string:
+		stored = value
+	case []byte:
+		stored = string(value)
+	default:
+		return fmt.Errorf("cannot scan %T into an encrypted field", src)
+	}
+	if stored == "" {
+		return nil
+	}
+	plaintext, err := fieldKeys.Decrypt(stored)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(plaintext, &e.Plain)
+}
+
+// Columns holding Encrypted values, re-encrypted by ReencryptProducts
+var encryptedProductColumns = []string{"supplier_cost"}
+
+type ReencryptReport struct {
+	Updated int `json:"updated"`
+}
+
+// Reencrypt rewrites encrypted columns still using an older key with the
+// current one, so retired keys can be dropped from the keyring
+func (repo *GenericRepository) Reencrypt() (ReencryptReport, error) {
+	var report ReencryptReport
+	if fieldKeys == nil {
+		return report, ErrEncryptionDisabled
+	}
+	current := encryptedPrefix + fieldKeys.current + ":%"
+	query := repo.DB.Model(&Product{})
+	for _, column := range encryptedProductColumns {
+		query = query.Or(column+" IS NOT NULL AND "+column+" <> '' AND "+column+" NOT LIKE ?", current)
+	}
+	var products []Product
+	result := query.FindInBatches(&products, reindexBatchSize, func(batch *gorm.DB, number int) error {
+		err := repo.DB.Transaction(func(tx *gorm.DB) error {
+			for i := range products {
+				// Saving the decrypted values encrypts them with the current key
+				err := tx.Model(&products[i]).Select(encryptedProductColumns).UpdateColumns(&products[i]).Error
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		report.Updated += len(products)
+		log.Printf("Reencrypt: batch %d done, %d products updated", number, report.Updated)
+		return nil
+	})
+	return report, result.Error
+}
+
+// Handlers
+func ReencryptProducts(w http.ResponseWriter, r *http.Request) {
+	report, err := productRepo.WithContext(r.Context()).Reencrypt()
+	if errors.Is(err, ErrEncryptionDisabled) {
+		http.Error(w, "Field encryption is not configured", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error re-encrypting products", http.StatusInternalServerError)
+		return
+	}
+	response := ApiResponse{Success: true, Data: report, Message: "Products re-encrypted successfully"}
+	respondWithJSON(w, r, response)
+}
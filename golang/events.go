@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	eventQueueSize = 256
+	// Events kept for retry while the broker is unreachable; the oldest are
+	// dropped beyond that
+	eventRetryBufferSize = 1000
+	eventRetryInterval   = 5 * time.Second
+)
+
+// MessageBroker is where product events are published, one subject per
+// event type
+type MessageBroker interface {
+	Publish(subject string, data []byte) error
+	Close() error
+}
+
+type natsBroker struct {
+	conn *nats.Conn
+}
+
+// NewNATSBroker connects to NATS, retrying in the background when the
+// server is down at startup
+func NewNATSBroker(url string) (MessageBroker, error) {
+	conn, err := nats.Connect(url, nats.RetryOnFailedConnect(true), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, err
+	}
+	return &natsBroker{conn: conn}, nil
+}
+
+func (b *natsBroker) Publish(subject string, data []byte) error {
+	if !b.conn.IsConnected() {
+		return nats.ErrConnectionClosed
+	}
+	return b.conn.Publish(subject, data)
+}
+
+// Close flushes what the client still buffers before disconnecting
+func (b *natsBroker) Close() error {
+	err := b.conn.Flush()
+	b.conn.Close()
+	return err
+}
+
+// EventPublisher sends product events to a broker from a background worker.
+// Failed publishes are buffered and retried, so a broker outage delays
+// events instead of losing them, up to eventRetryBufferSize.
+type EventPublisher struct {
+	broker  MessageBroker
+	prefix  string
+	queue   chan ProductEvent
+	pending []ProductEvent
+	// mu guards closed, so a request still running at shutdown can't send
+	// on the closed queue
+	mu     sync.Mutex
+	closed bool
+}
+
+func NewEventPublisher(broker MessageBroker, prefix string) *EventPublisher {
+	return &EventPublisher{broker: broker, prefix: prefix, queue: make(chan ProductEvent, eventQueueSize)}
+}
+
+var events *EventPublisher
+
+// Start publishes queued events until Close is called
+func (p *EventPublisher) Start(wg *sync.WaitGroup) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(eventRetryInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case event, ok := <-p.queue:
+				if !ok {
+					p.retry()
+					if len(p.pending) > 0 {
+						log.Printf("Dropping %d unpublished events on shutdown", len(p.pending))
+					}
+					if err := p.broker.Close(); err != nil {
+						log.Println("Error closing message broker: ", err)
+					}
+					return
+				}
+				p.retry()
+				p.publish(event)
+			case <-ticker.C:
+				p.retry()
+			}
+		}
+	}()
+}
+
+// Close stops accepting events; the worker exits once the queue is drained
+func (p *EventPublisher) Close() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	close(p.queue)
+}
+
+// Publish queues an event, a no-op when no broker is configured
+func (p *EventPublisher) Publish(eventType string, product interface{}) {
+	if p == nil {
+		return
+	}
+	event := ProductEvent{Type: eventType, Product: product, OccurredAt: time.Now().UTC()}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		log.Printf("Shutting down, dropping %s event", eventType)
+		return
+	}
+	select {
+	case p.queue <- event:
+	default:
+		log.Printf("Event queue full, dropping %s event", eventType)
+	}
+}
+
+func (p *EventPublisher) publish(event ProductEvent) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		log.Println("Error encoding event: ", err)
+		return
+	}
+	if err := p.broker.Publish(p.prefix+"."+event.Type, body); err != nil {
+		log.Printf("Publishing %s event failed, will retry: %v", event.Type, err)
+		if len(p.pending) == eventRetryBufferSize {
+			p.pending = p.pending[1:]
+		}
+		p.pending = append(p.pending, event)
+	}
+}
+
+// retry republishes buffered events in order, stopping at the first failure
+func (p *EventPublisher) retry() {
+	for len(p.pending) > 0 {
+		event := p.pending[0]
+		body, _ := json.Marshal(event)
+		if err := p.broker.Publish(p.prefix+"."+event.Type, body); err != nil {
+			return
+		}
+		p.pending = p.pending[1:]
+	}
+}
+
+// emitEvent announces a committed product change to webhooks and the broker.
+// Inside a Transactional handler the audit entry is part of the transaction
+// and the announcement waits for the commit.
+func emitEvent(ctx context.Context, eventType string, product interface{}) {
+	recordAudit(ctx, eventType, product)
+	if state, ok := ctx.Value(transactionContextKey).(*requestTransaction); ok {
+		state.events = append(state.events, pendingEvent{eventType: eventType, payload: product})
+		return
+	}
+	publishEvent(eventType, product)
+}
+
+func publishEvent(eventType string, product interface{}) {
+	if featureEnabled("webhooks") {
+		webhooks.Dispatch(eventType, product)
+	}
+	events.Publish(eventType, product)
+}
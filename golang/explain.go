@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+
+	"gorm.io/gorm"
+)
+
+type ExplainedQuery struct {
+	SQL  string        `json:"sql"`
+	Args []interface{} `json:"args"`
+}
+
+// ExplainGetAll builds the statements GetAll would run for opts without
+// executing them
+func (repo *GenericRepository) ExplainGetAll(opts ListOptions) []ExplainedQuery {
+	dry := repo.DB.Session(&gorm.Session{DryRun: true})
+	var total int64
+	var products []Product
+	statements := []*gorm.Statement{
+		listQuery(dry, opts).Count(&total).Statement,
+		listQuery(dry, opts).Scopes(ordered(opts), paginate(opts)).Find(&products).Statement,
+	}
+	queries := make([]ExplainedQuery, len(statements))
+	for i, statement := range statements {
+		queries[i] = ExplainedQuery{SQL: statement.SQL.String(), Args: statement.Vars}
+	}
+	return queries
+}
+
+// explainProducts answers GET /products?explain=true, only served with DEBUG
+// set since it exposes the schema
+func explainProducts(w http.ResponseWriter, r *http.Request, opts ListOptions) {
+	queries := productRepo.WithContext(r.Context()).ExplainGetAll(opts)
+	response := ApiResponse{Success: true, Data: queries, Message: "Queries explained"}
+	respondWithJSON(w, r, response)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+)
+
+// Rows written between flushes while streaming an export
+const exportFlushEvery = 100
+
+// Handlers
+
+// ExportProducts streams the products matching the list filters, so a
+// slice of the catalog such as one category can be exported on its own.
+//
+// Without a sort parameter products are exported by id, and an export cut
+// short is resumed by passing the id of the last complete product as
+// ?after_id. A resumed export can't be sorted, since ids are its cursor.
+func ExportProducts(w http.ResponseWriter, r *http.Request) {
+	params := NewQueryParams(r)
+	opts := parseProductListOptions(params)
+	afterID := params.Int("after_id", 0, 1, math.MaxInt32)
+	if params.values.Get("sort") == "" {
+		opts.Order = "id"
+	} else if afterID > 0 {
+		params.addError("after_id cannot be combined with sort")
+	}
+	format := params.values.Get("format")
+	if format == "" {
+		format = "ndjson"
+	}
+	if format != "ndjson" && format != "json" {
+		params.addError("format must be ndjson or json")
+	}
+	if !params.Valid() {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid query parameters", params.Errors)
+		return
+	}
+
+	repo := productRepo.WithContext(r.Context())
+	query := listQuery(repo.DB, opts)
+	if afterID > 0 {
+		query = query.Where("id > ?", afterID)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		http.Error(w, "Error exporting products", http.StatusInternalServerError)
+		return
+	}
+	rows, err := query.Scopes(ordered(opts), paginate(opts)).Rows()
+	if err != nil {
+		http.Error(w, "Error exporting products", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	// The stream has no envelope, so a capped export is flagged in a header
+	if opts.PageSize == 0 && total > int64(config.MaxResults) {
+		w.Header().Set("X-Results-Truncated", "true")
+	}
+
+	if format == "ndjson" {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("["))
+	}
+	flusher, _ := w.(http.Flusher)
+	count := 0
+	for rows.Next() {
+		var product Product
+		if err := repo.DB.ScanRows(rows, &product); err != nil {
+			log.Println("Error scanning exported product: ", err)
+			return
+		}
+		line, err := json.Marshal(product)
+		if err != nil {
+			log.Println("Error encoding exported product: ", err)
+			return
+		}
+		line = withoutRestrictedFields(r, line)
+		if format == "json" && count > 0 {
+			w.Write([]byte(","))
+		}
+		w.Write(line)
+		if format == "ndjson" {
+			w.Write([]byte("\n"))
+		}
+		count++
+		if flusher != nil && count%exportFlushEvery == 0 {
+			flusher.Flush()
+		}
+	}
+	if err := rows.Err(); err != nil {
+		// Headers are already sent, so all we can do is cut the stream short
+		log.Println("Error reading exported products: ", err)
+		return
+	}
+	if format == "json" {
+		w.Write([]byte("]\n"))
+	}
+}
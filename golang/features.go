@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// featureDefaults lists every feature flag with its state when FEATURE_FLAGS
+// doesn't set it. New features can be added switched off and enabled per
+// environment once they are ready.
+var featureDefaults = map[string]bool{
+	"bulk_upsert":   true,
+	"product_merge": true,
+	"atom_feed":     true,
+	"webhooks":      true,
+}
+
+func featureEnabled(name string) bool {
+	if enabled, ok := config.FeatureFlags[name]; ok {
+		return enabled
+	}
+	return featureDefaults[name]
+}
+
+// checkFeatureFlags reports flags set in FEATURE_FLAGS that don't exist,
+// which are most likely typos
+func checkFeatureFlags(flags map[string]bool) error {
+	var unknown []string
+	for name := range flags {
+		if _, ok := featureDefaults[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("unknown features %v", unknown)
+	}
+	return nil
+}
+
+// Feature gates a route behind a flag. A disabled feature answers 404, as
+// if the endpoint didn't exist.
+func Feature(name string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !featureEnabled(name) {
+			http.NotFound(w, r)
+			return
+		}
+		next(w, r)
+	}
+}
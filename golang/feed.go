@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultFeedSize = 50
+	atomNamespace   = "http://www.w3.org/2005/Atom"
+)
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	ID        string   `xml:"id"`
+	Title     string   `xml:"title"`
+	Updated   string   `xml:"updated"`
+	Published string   `xml:"published"`
+	Link      atomLink `xml:"link"`
+	Summary   string   `xml:"summary,omitempty"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"feed"`
+	Xmlns   string      `xml:"xmlns,attr"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  string      `xml:"author>name"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+// GetFeed returns products most recently updated first, which includes new
+// products since creation sets updated_at too
+func (repo *GenericRepository) GetFeed(opts ListOptions) ([]Product, int64, error) {
+	var total int64
+	query := repo.DB.Model(&Product{}).Where("is_deleted = ?", false)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	products := []Product{}
+	err := query.Order("updated_at DESC, id DESC").Scopes(paginate(opts)).Find(&products).Error
+	return products, total, err
+}
+
+// requestBaseURL is the scheme and host the client used to reach us
+func requestBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// feedHost is the tagging authority of entry ids, which can't carry a port
+func feedHost(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.Host); err == nil {
+		return host
+	}
+	return r.Host
+}
+
+// productEntryID is a tag URI (RFC 4151), dated by creation so it never
+// changes for the life of the product
+func productEntryID(r *http.Request, product Product) string {
+	return fmt.Sprintf("tag:%s,%s:products/%d", feedHost(r), product.CreatedAt.UTC().Format("2006-01-02"), product.ID)
+}
+
+// Handlers
+func GetProductFeed(w http.ResponseWriter, r *http.Request) {
+	params := NewQueryParams(r)
+	opts := ListOptions{
+		Page:     params.Int("page", 1, 1, math.MaxInt32),
+		PageSize: params.Int("page_size", defaultFeedSize, 1, maxPageSize),
+	}
+	if !params.Valid() {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid query parameters", params.Errors)
+		return
+	}
+	products, total, err := productRepo.WithContext(r.Context()).GetFeed(opts)
+	if err != nil {
+		http.Error(w, "Error fetching products", http.StatusInternalServerError)
+		return
+	}
+
+	base := requestBaseURL(r)
+	pageLink := func(page int) string {
+		return fmt.Sprintf("%s/products/feed.xml?page=%d&page_size=%d", base, page, opts.PageSize)
+	}
+	feed := atomFeed{
+		Xmlns:   atomNamespace,
+		ID:      "tag:" + feedHost(r) + ",2024:products",
+		Title:   "Products",
+		Updated: time.Now().UTC().Format(time.RFC3339),
+		Author:  feedHost(r),
+		Links: []atomLink{
+			{Rel: "self", Href: pageLink(opts.Page)},
+			{Rel: "first", Href: pageLink(1)},
+		},
+	}
+	// Paged feeds per RFC 5005
+	if opts.Page > 1 {
+		feed.Links = append(feed.Links, atomLink{Rel: "previous", Href: pageLink(opts.Page - 1)})
+	}
+	if int64(opts.Page*opts.PageSize) < total {
+		feed.Links = append(feed.Links, atomLink{Rel: "next", Href: pageLink(opts.Page + 1)})
+	}
+	if len(products) > 0 {
+		feed.Updated = products[0].UpdatedAt.UTC().Format(time.RFC3339)
+	}
+	for _, product := range products {
+		feed.Entries = append(feed.Entries, atomEntry{
+			ID:        productEntryID(r, product),
+			Title:     product.Name,
+			Updated:   product.UpdatedAt.UTC().Format(time.RFC3339),
+			Published: product.CreatedAt.UTC().Format(time.RFC3339),
+			Link:      atomLink{Rel: "alternate", Href: base + "/products/" + strconv.FormatUint(uint64(product.ID), 10)},
+			Summary:   product.Description,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	w.Write([]byte(xml.Header))
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	encoder.Encode(feed)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const readinessTimeout = 2 * time.Second
+
+type ReadinessCheck struct {
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// CheckReadiness pings the database and verifies the schema has been
+// migrated. It goes around the circuit breaker, so it reports on the
+// database even while the breaker is open.
+func CheckReadiness(ctx context.Context) []ReadinessCheck {
+	ctx, cancel := context.WithTimeout(withoutCircuitBreaker(ctx), readinessTimeout)
+	defer cancel()
+
+	database := ReadinessCheck{Name: "database", OK: true}
+	sqlDB, err := db.DB()
+	if err == nil {
+		err = sqlDB.PingContext(ctx)
+	}
+	if err != nil {
+		database.OK = false
+		database.Error = err.Error()
+		return []ReadinessCheck{database}
+	}
+
+	migrations := ReadinessCheck{Name: "migrations", OK: true}
+	migrator := db.WithContext(ctx).Migrator()
+	for _, model := range models {
+		if !migrator.HasTable(model) {
+			migrations.OK = false
+			migrations.Error = "missing tables"
+			return []ReadinessCheck{database, migrations}
+		}
+	}
+	// Rolling deploys may briefly run older builds on a newer schema, which
+	// migrations keep compatible; only a schema behind the code is fatal
+	version, err := migratedVersion(db.WithContext(ctx))
+	switch {
+	case err != nil:
+		migrations.OK = false
+		migrations.Error = err.Error()
+	case version < schemaVersion:
+		migrations.OK = false
+		migrations.Error = fmt.Sprintf("schema version %d is behind the expected version %d", version, schemaVersion)
+	}
+	return []ReadinessCheck{database, migrations}
+}
+
+// Handlers
+
+// Livez only says the process is serving requests. It never touches the
+// database, so an outage doesn't get the service restarted in a loop.
+func Livez(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// Readyz fails while the database is unreachable, taking the instance out of
+// rotation until it recovers. The breaker state is reported alongside; an
+// open breaker alone doesn't fail readiness, since it closes by itself once
+// the database answers again.
+func Readyz(w http.ResponseWriter, r *http.Request) {
+	checks := CheckReadiness(r.Context())
+	status, code := "ok", http.StatusOK
+	for _, check := range checks {
+		if !check.OK {
+			status, code = "unavailable", http.StatusServiceUnavailable
+		}
+	}
+	writeJSON(w, r, code, map[string]interface{}{"status": status, "checks": checks, "circuit_breaker": dbBreaker.State()})
+}
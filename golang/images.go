@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// ImageOrderError lists why an order doesn't match a product's images
+type ImageOrderError struct {
+	Errors []string
+}
+
+func (e *ImageOrderError) Error() string {
+	return "image order does not match the product's images"
+}
+
+func (repo *GenericRepository) GetImages(productID uint) ([]ProductImage, error) {
+	images := []ProductImage{}
+	err := repo.DB.Where("product_id = ?", productID).Order("position, id").Find(&images).Error
+	return images, err
+}
+
+// ReorderImages sets the gallery order of a product, first image first. The
+// ids must be exactly the product's images, each listed once.
+func (repo *GenericRepository) ReorderImages(productID uint, ids []uint) ([]ProductImage, error) {
+	var images []ProductImage
+	err := repo.DB.Transaction(func(tx *gorm.DB) error {
+		txRepo := &GenericRepository{DB: tx}
+		if _, err := txRepo.GetById(productID); err != nil {
+			return err
+		}
+		current, err := txRepo.GetImages(productID)
+		if err != nil {
+			return err
+		}
+		if errs := checkImageOrder(current, ids); len(errs) > 0 {
+			return &ImageOrderError{Errors: errs}
+		}
+		for position, id := range ids {
+			err := tx.Model(&ProductImage{}).Where("id = ? AND product_id = ?", id, productID).
+				Update("position", position).Error
+			if err != nil {
+				return err
+			}
+		}
+		images, err = txRepo.GetImages(productID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+func checkImageOrder(images []ProductImage, ids []uint) []string {
+	var errs []string
+	owned := make(map[uint]bool, len(images))
+	for _, image := range images {
+		owned[image.ID] = true
+	}
+	listed := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		switch {
+		case listed[id]:
+			errs = append(errs, fmt.Sprintf("image %d is listed more than once", id))
+		case !owned[id]:
+			errs = append(errs, fmt.Sprintf("image %d does not belong to the product", id))
+		}
+		listed[id] = true
+	}
+	var missing []uint
+	for id := range owned {
+		if !listed[id] {
+			missing = append(missing, id)
+		}
+	}
+	sort.Slice(missing, func(i, j int) bool { return missing[i] < missing[j] })
+	for _, id := range missing {
+		errs = append(errs, fmt.Sprintf("image %d is missing from the order", id))
+	}
+	return errs
+}
+
+type imageOrderRequest struct {
+	ImageIDs []uint `json:"image_ids"`
+}
+
+// Handlers
+func ReorderProductImages(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	productID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+	var request imageOrderRequest
+	if err := decodeBody(r, &request); err != nil {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid input", []string{err.Error()})
+		return
+	}
+	images, err := productRepo.WithContext(r.Context()).ReorderImages(uint(productID), request.ImageIDs)
+	var orderErr *ImageOrderError
+	if errors.As(err, &orderErr) {
+		respondWithError(w, r, http.StatusUnprocessableEntity, "Invalid image order", orderErr.Errors)
+		return
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error reordering images", http.StatusInternalServerError)
+		return
+	}
+	auditChanges(r.Context(), []uint{uint(productID)}, AuditImagesReordered, map[string][]uint{"image_ids": request.ImageIDs})
+	response := ApiResponse{Success: true, Data: images, Message: "Images reordered successfully"}
+	respondWithJSON(w, r, response)
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+const (
+	defaultStreamBatchSize = 500
+	maxStreamBatchSize     = 5000
+	// Longest NDJSON line accepted, so one bad line can't exhaust memory
+	maxStreamLineSize = 1 << 20
+)
+
+// StreamImportProgress is written as one NDJSON line after every batch,
+// with running totals and the errors since the previous line, up to
+// maxJobErrors of them. The last line has Done set, or Error when the import
+// stopped early.
+type StreamImportProgress struct {
+	Processed int      `json:"processed"`
+	Created   int      `json:"created"`
+	Failed    int      `json:"failed"`
+	Errors    []string `json:"errors,omitempty"`
+	Done      bool     `json:"done"`
+	Error     string   `json:"error,omitempty"`
+}
+
+func (p *StreamImportProgress) fail(line int, err error) {
+	p.Failed++
+	if len(p.Errors) < maxJobErrors {
+		p.Errors = append(p.Errors, fmt.Sprintf("line %d: %v", line, err))
+	}
+}
+
+type streamedProduct struct {
+	line    int
+	product Product
+}
+
+// decodeLine decodes one NDJSON line with the same rules as decodeBody
+func decodeLine(line []byte, v interface{}) error {
+	decoder := newDecoder(bytes.NewReader(line))
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if decoder.More() {
+		return errors.New("more than one value on the line")
+	}
+	return nil
+}
+
+// checkLinePermissions applies checkFieldPermissions to a decoded line
+func checkLinePermissions(ctx context.Context, line []byte, product *Product) error {
+	fields, err := jsonFields(line)
+	if err != nil {
+		return err
+	}
+	if errs := checkFieldPermissions(ctx, fields, product, nil); len(errs) > 0 {
+		return errors.New(strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// createBatch creates a batch of valid products in one transaction. Each
+// product gets a savepoint, so a conflict only fails its own line.
+func (repo *GenericRepository) createBatch(batch []streamedProduct, progress *StreamImportProgress) ([]*Product, error) {
+	var created []*Product
+	failed := *progress
+	err := repo.DB.Transaction(func(tx *gorm.DB) error {
+		created = nil
+		for i := range batch {
+			product := batch[i].product
+			err := tx.Transaction(func(itemTx *gorm.DB) error {
+				_, err := (&GenericRepository{DB: itemTx}).Create(&product)
+				return err
+			})
+			if isReadOnlyError(err) {
+				return err
+			}
+			if message := conflictMessage(err); message != "" {
+				err = errors.New(message)
+			}
+			if err != nil {
+				failed.fail(batch[i].line, err)
+				continue
+			}
+			created = append(created, &product)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	failed.Created += len(created)
+	*progress = failed
+	return created, nil
+}
+
+// Handlers
+
+// StreamImportProducts creates products from an NDJSON body, one product per
+// line, without holding the whole body in memory. Lines are validated and
+// inserted in batches of batch_size, and progress is streamed back as NDJSON
+// after each batch. Invalid lines are reported and skipped; the import only
+// stops early on an unreadable body or a database error, and batches
+// committed before that are kept.
+func StreamImportProducts(w http.ResponseWriter, r *http.Request) {
+	params := NewQueryParams(r)
+	batchSize := params.Int("batch_size", defaultStreamBatchSize, 1, maxStreamBatchSize)
+	if !params.Valid() {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid query parameters", params.Errors)
+		return
+	}
+
+	// Progress goes out while the body is still being read
+	if err := http.NewResponseController(w).EnableFullDuplex(); err != nil {
+		log.Println("Stream import without full duplex: ", err)
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+
+	ctx := r.Context()
+	repo := productRepo.WithContext(ctx)
+	var progress StreamImportProgress
+	var batch []streamedProduct
+	report := func() {
+		encoder.Encode(progress)
+		if flusher != nil {
+			flusher.Flush()
+		}
+		progress.Errors = nil
+	}
+	flush := func() error {
+		created, err := repo.createBatch(batch, &progress)
+		if err != nil {
+			return err
+		}
+		for _, product := range created {
+			emitEvent(ctx, EventProductCreated, product)
+		}
+		batch = batch[:0]
+		return nil
+	}
+	fail := func(err error) {
+		log.Println("Error importing products: ", err)
+		progress.Error = "Error saving products"
+		if isReadOnlyError(err) {
+			progress.Error = "Service temporarily read-only"
+		}
+		report()
+	}
+
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(make([]byte, 64*1024), maxStreamLineSize)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		progress.Processed++
+		var product Product
+		err := decodeLine(text, &product)
+		if err == nil {
+			if errs := product.Validate(); len(errs) > 0 {
+				err = errors.New(strings.Join(errs, ", "))
+			}
+		}
+		if err == nil {
+			err = checkLinePermissions(ctx, text, &product)
+		}
+		if err != nil {
+			progress.fail(line, err)
+			continue
+		}
+		batch = append(batch, streamedProduct{line: line, product: product})
+		if len(batch) >= batchSize {
+			if err := flush(); err != nil {
+				fail(err)
+				return
+			}
+			report()
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		progress.Error = "Error reading request body"
+		if errors.Is(err, bufio.ErrTooLong) {
+			progress.Error = fmt.Sprintf("line %d is longer than %d bytes", line+1, maxStreamLineSize)
+		}
+		report()
+		return
+	}
+	if len(batch) > 0 {
+		if err := flush(); err != nil {
+			fail(err)
+			return
+		}
+	}
+	progress.Done = true
+	report()
+}
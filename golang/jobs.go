@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	jobQueueSize = 16
+	// Finished jobs are forgotten after this long
+	jobRetention = 24 * time.Hour
+	// Errors kept per job; the failed count keeps going past it
+	maxJobErrors  = 100
+	maxImportSize = 10000
+)
+
+// Job statuses
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+type Job struct {
+	ID         uint       `json:"id"`
+	Type       string     `json:"type"`
+	Status     string     `json:"status"`
+	Total      int        `json:"total"`
+	Processed  int        `json:"processed"`
+	Failed     int        `json:"failed"`
+	Errors     []string   `json:"errors"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
+
+// JobProgress is handed to a running job to report on each item
+type JobProgress struct {
+	queue *JobQueue
+	job   *Job
+}
+
+// Done records one processed item, failed when err is not nil
+func (p JobProgress) Done(err error) {
+	p.queue.mu.Lock()
+	defer p.queue.mu.Unlock()
+	p.job.Processed++
+	if err != nil {
+		p.job.Failed++
+		if len(p.job.Errors) < maxJobErrors {
+			p.job.Errors = append(p.job.Errors, fmt.Sprintf("item %d: %v", p.job.Processed-1, err))
+		}
+	}
+}
+
+type queuedJob struct {
+	job *Job
+	run func(ctx context.Context, progress JobProgress) error
+}
+
+// JobQueue runs slow operations one at a time on a background worker and
+// keeps their state in memory, so it's lost on restart.
+type JobQueue struct {
+	mu     sync.Mutex
+	jobs   map[uint]*Job
+	nextID uint
+	queue  chan queuedJob
+}
+
+func NewJobQueue() *JobQueue {
+	return &JobQueue{jobs: map[uint]*Job{}, nextID: 1, queue: make(chan queuedJob, jobQueueSize)}
+}
+
+var jobQueue *JobQueue
+
+var ErrJobQueueFull = errors.New("job queue is full")
+
+// Start runs queued jobs until ctx is cancelled. A job running at shutdown
+// sees the cancelled context and stops between items.
+func (q *JobQueue) Start(ctx context.Context, wg *sync.WaitGroup) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case queued := <-q.queue:
+				q.setStatus(queued.job, JobRunning)
+				err := queued.run(ctx, JobProgress{queue: q, job: queued.job})
+				q.finish(queued.job, err)
+			}
+		}
+	}()
+}
+
+// Enqueue registers a job of the given type and size and queues it
+func (q *JobQueue) Enqueue(jobType string, total int, run func(ctx context.Context, progress JobProgress) error) (Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.prune()
+	job := &Job{ID: q.nextID, Type: jobType, Status: JobQueued, Total: total, Errors: []string{}, CreatedAt: time.Now().UTC()}
+	select {
+	case q.queue <- queuedJob{job: job, run: run}:
+	default:
+		return Job{}, ErrJobQueueFull
+	}
+	q.nextID++
+	q.jobs[job.ID] = job
+	return q.snapshot(job), nil
+}
+
+// Get returns a copy of the job's current state
+func (q *JobQueue) Get(id uint) (Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, ok := q.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return q.snapshot(job), true
+}
+
+func (q *JobQueue) setStatus(job *Job, status string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job.Status = status
+}
+
+func (q *JobQueue) finish(job *Job, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := time.Now().UTC()
+	job.FinishedAt = &now
+	job.Status = JobSucceeded
+	if err != nil {
+		job.Status = JobFailed
+		job.Errors = append(job.Errors, err.Error())
+	}
+}
+
+// snapshot copies a job; the lock must be held
+func (q *JobQueue) snapshot(job *Job) Job {
+	copied := *job
+	copied.Errors = append([]string{}, job.Errors...)
+	return copied
+}
+
+// prune drops jobs that finished more than jobRetention ago; the lock must be held
+func (q *JobQueue) prune() {
+	for id, job := range q.jobs {
+		if job.FinishedAt != nil && time.Since(*job.FinishedAt) > jobRetention {
+			delete(q.jobs, id)
+		}
+	}
+}
+
+// importProducts creates the products one by one, reporting each failure
+// without stopping the import
+func importProducts(products []Product, userID string) func(ctx context.Context, progress JobProgress) error {
+	return func(ctx context.Context, progress JobProgress) error {
+		ctx = withUser(ctx, userID)
+		repo := productRepo.WithContext(ctx)
+		for i := range products {
+			if ctx.Err() != nil {
+				return errors.New("interrupted by shutdown")
+			}
+			product := products[i]
+			if errs := product.Validate(); len(errs) > 0 {
+				progress.Done(errors.New(strings.Join(errs, ", ")))
+				continue
+			}
+			created, err := repo.Create(&product)
+			if message := conflictMessage(err); message != "" {
+				err = errors.New(message)
+			}
+			if err == nil {
+				emitEvent(ctx, EventProductCreated, created)
+			}
+			progress.Done(err)
+		}
+		return nil
+	}
+}
+
+// ImportReport lists every invalid item of an import, keyed by its index in
+// the array as in the job's errors
+type ImportReport struct {
+	Items   int              `json:"items"`
+	Valid   int              `json:"valid"`
+	Invalid int              `json:"invalid"`
+	Errors  map[int][]string `json:"errors"`
+}
+
+type QueuedImport struct {
+	Job
+	Report *ImportReport `json:"report"`
+}
+
+// ValidateImport checks a whole import up front with the create rules,
+// uniqueness against the catalog and within the import included, so every
+// problem is reported at once
+func (repo *GenericRepository) ValidateImport(products []Product) (*ImportReport, error) {
+	report := &ImportReport{Items: len(products), Errors: map[int][]string{}}
+	skus := map[string]bool{}
+	names := map[string]bool{}
+	for i := range products {
+		product := &products[i]
+		errs := product.Validate()
+		err := repo.checkConflicts(product)
+		if message := conflictMessage(err); message != "" {
+			errs = append(errs, message)
+		} else if err != nil {
+			return nil, err
+		}
+		if product.SKU != "" {
+			if skus[product.SKU] {
+				errs = append(errs, "sku appears more than once in the import")
+			}
+			skus[product.SKU] = true
+		}
+		if product.CategoryID != nil {
+			key := fmt.Sprintf("%d:%s", *product.CategoryID, strings.ToLower(product.Name))
+			if names[key] {
+				errs = append(errs, "name appears more than once in the category in the import")
+			}
+			names[key] = true
+		}
+		if len(errs) > 0 {
+			report.Errors[i] = errs
+		}
+	}
+	report.Invalid = len(report.Errors)
+	report.Valid = report.Items - report.Invalid
+	return report, nil
+}
+
+// Handlers
+
+// ImportProductsJob validates the whole import before queueing it. With any
+// invalid item it answers 422 with the report, unless skip_invalid is set:
+// then the valid items are imported and the invalid ones fail in the job.
+func ImportProductsJob(w http.ResponseWriter, r *http.Request) {
+	params := NewQueryParams(r)
+	skipInvalid := params.Bool("skip_invalid", false)
+	if !params.Valid() {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid query parameters", params.Errors)
+		return
+	}
+	var products []Product
+	fields, err := decodeBodyItemFields(r, &products)
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid input", []string{err.Error()})
+		return
+	}
+	if len(products) == 0 || len(products) > maxImportSize {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid input", []string{fmt.Sprintf("import must contain between 1 and %d products", maxImportSize)})
+		return
+	}
+	var forbidden []string
+	for i := range products {
+		for _, message := range checkFieldPermissions(r.Context(), fields[i], &products[i], nil) {
+			forbidden = append(forbidden, fmt.Sprintf("item %d: %s", i, message))
+		}
+	}
+	if len(forbidden) > 0 {
+		respondWithError(w, r, http.StatusForbidden, "Forbidden", forbidden)
+		return
+	}
+	report, err := productRepo.WithContext(r.Context()).ValidateImport(products)
+	if err != nil {
+		http.Error(w, "Error validating import", http.StatusInternalServerError)
+		return
+	}
+	if report.Invalid > 0 && (!skipInvalid || report.Valid == 0) {
+		message := fmt.Sprintf("%d of %d products are invalid", report.Invalid, report.Items)
+		response := ApiResponse{Success: false, Data: report, Message: message}
+		respondWithJSONStatus(w, r, http.StatusUnprocessableEntity, response)
+		return
+	}
+	job, err := jobQueue.Enqueue("import", len(products), importProducts(products, userFromContext(r.Context())))
+	if errors.Is(err, ErrJobQueueFull) {
+		http.Error(w, "Too many jobs queued, try again later", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/jobs/%d", job.ID))
+	response := ApiResponse{Success: true, Data: QueuedImport{Job: job, Report: report}, Message: "Import queued"}
+	respondWithJSONStatus(w, r, http.StatusAccepted, response)
+}
+
+func GetJob(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	jobID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid job ID", http.StatusBadRequest)
+		return
+	}
+	job, ok := jobQueue.Get(uint(jobID))
+	if !ok {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	response := ApiResponse{Success: true, Data: job, Message: "Job retrieved successfully"}
+	respondWithJSON(w, r, response)
+}
@@ -1,32 +1,84 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
 	"net/http"
 	"github.com/gorilla/mux"
+	"golang.org/x/sync/singleflight"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"gorm.io/driver/sqlite"
+	"os"
+	"os/signal"
 	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 )
 
 type Product struct {
 	ID          uint    `json:"id"`
 	Name        string  `json:"name"`
-	Price       float64 `json:"price"`
+	SKU         string  `json:"sku"`
+	Price       Price   `json:"price" gorm:"index"`
 	Description string  `json:"description"`
 	StockQuantity int   `json:"stock_quantity"`
-	IsDeleted   bool    `json:"is_deleted"`
-	CreatedAt   string  `json:"created_at"`
-	UpdatedAt   string  `json:"updated_at"`
+	CategoryID  *uint   `json:"category_id" gorm:"index"`
+	ViewCount   int     `json:"view_count" gorm:"index;not null;default:0"`
+	// SupplierCost and Cost are only returned to the roles in restrictedFields
+	SupplierCost Encrypted[float64] `json:"supplier_cost"`
+	ReorderPoint *int   `json:"reorder_point"`
+	ReorderTarget *int  `json:"reorder_target"`
+	// Cost is stored in plain text, unlike SupplierCost, so lists can sort by margin
+	Cost        *Price  `json:"cost"`
+	IsDeleted   bool    `json:"is_deleted" gorm:"index"`
+	DeletedAt   *time.Time `json:"deleted_at"`
+	DeletedReason string `json:"deleted_reason"`
+	CreatedAt   time.Time `json:"created_at" gorm:"index"`
+	UpdatedAt   time.Time `json:"updated_at" gorm:"index"`
+	SearchText  string  `json:"-"`
+}
+
+// Keep derived columns in sync on every create and save, and the total
+// stock at or above what the warehouses hold
+func (product *Product) BeforeSave(tx *gorm.DB) error {
+	product.SearchText = productSearchText(product)
+	if product.ID == 0 || product.IsDeleted {
+		return nil
+	}
+	return checkWarehouseStock(tx.Session(&gorm.Session{NewDB: true}), product.ID, product.StockQuantity)
+}
+
+// AfterSave keeps the price history and stock ledger. Column updates on an
+// empty model have no id and are skipped; the ones writing stock record
+// their own movements.
+func (product *Product) AfterSave(tx *gorm.DB) error {
+	if product.ID == 0 {
+		return nil
+	}
+	tx = tx.Session(&gorm.Session{NewDB: true})
+	if err := product.recordPriceChange(tx); err != nil {
+		return err
+	}
+	return product.recordStockChange(tx)
 }
 
 type ApiResponse struct {
-	Success bool        `json:"success"`
-	Data    interface{} `json:"data"`
-	Message string      `json:"message"`
-	Errors  []string    `json:"errors"`
+	Success  bool        `json:"success"`
+	Data     interface{} `json:"data"`
+	Message  string      `json:"message"`
+	Errors   []string    `json:"errors"`
+	Meta     interface{} `json:"meta,omitempty"`
+	Warnings []string    `json:"warnings,omitempty"`
 }
 
 var db *gorm.DB
@@ -34,60 +86,291 @@ var err error
 
 // Initialize the database
 func InitDb() {
-	db, err = gorm.Open(sqlite.Open("./product.db"), &gorm.Config{})
+	db, err = gorm.Open(sqlite.Open("./product.db"), &gorm.Config{
+		TranslateError: true,
+		NowFunc:        utcNow,
+		Logger:         newSlogGormLogger(config.SlowQueryThreshold),
+	})
     if err != nil {
         log.Fatal("Error connecting to database: ", err)
     }
-    db.AutoMigrate(&Product{})
+	if err := registerTracingCallbacks(db); err != nil {
+		log.Fatal("Error registering tracing callbacks: ", err)
+	}
+	if err := registerReadOnlyCallbacks(db); err != nil {
+		log.Fatal("Error registering read-only callbacks: ", err)
+	}
+	dbBreaker = NewCircuitBreaker(config.DBBreakerThreshold, config.DBBreakerCooldown)
+	if err := registerBreakerCallbacks(db, dbBreaker); err != nil {
+		log.Fatal("Error registering circuit breaker callbacks: ", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		log.Fatal("Error getting database handle: ", err)
+	}
+	configurePool(sqlDB)
+	if err := migrate(db); err != nil {
+		log.Fatal("Error migrating database: ", err)
+	}
+}
+
+// schemaVersion is the schema this build expects. Bump it whenever migrate
+// changes, so instances don't report ready against an older database.
+const schemaVersion = 4
+
+// SchemaMigration is the single row recording the migrated schema version
+type SchemaMigration struct {
+	ID         uint `gorm:"primaryKey"`
+	Version    int
+	MigratedAt time.Time
+}
+
+// migrate brings a database up to the current schema
+func migrate(database *gorm.DB) error {
+	if err := database.AutoMigrate(models...); err != nil {
+		return fmt.Errorf("migrating tables: %w", err)
+	}
+	// Timestamps used to be stored as empty strings
+	for _, column := range []string{"created_at", "updated_at"} {
+		database.Exec("UPDATE products SET " + column + " = CURRENT_TIMESTAMP WHERE " + column + " = ''")
+	}
+	// Partial index so soft-deleted products don't hold on to their SKU
+	err := database.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_products_active_sku ON products (sku) WHERE is_deleted = false AND sku <> ''").Error
+	if err != nil {
+		return fmt.Errorf("creating SKU index: %w", err)
+	}
+	// Only ever raised: an older build restarting during a rolling deploy
+	// must not record its version over a newer one
+	migration := SchemaMigration{ID: 1, Version: schemaVersion, MigratedAt: time.Now().UTC()}
+	return database.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"version", "migrated_at"}),
+		Where:     clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "schema_migrations.version < excluded.version"}}},
+	}).Create(&migration).Error
+}
+
+// migratedVersion is the schema version of a database, 0 before versioning
+func migratedVersion(database *gorm.DB) (int, error) {
+	var migration SchemaMigration
+	err := database.Find(&migration, 1).Error
+	return migration.Version, err
 }
 
+// Models managed by AutoMigrate
+var models = []interface{}{&Product{}, &Category{}, &ProductImage{}, &Tag{}, &ProductTag{}, &RelatedProduct{}, &Reservation{}, &ProductTranslation{}, &AuditEntry{}, &PriceTier{}, &WarehouseStock{}, &PriceChange{}, &CurrencyRate{}, &StockMovement{}, &OrderItem{}, &SchemaMigration{}}
+
+var (
+	ErrDuplicateSKU  = errors.New("sku already in use")
+	ErrDuplicateName = errors.New("name already in use in category")
+	// ErrProductDeleted is returned when writing to a soft-deleted product
+	ErrProductDeleted = errors.New("product is deleted")
+)
+
 // Generic repository for CRUD operations
 type GenericRepository struct {
 	DB *gorm.DB
 }
 
-func (repo *GenericRepository) GetAll() ([]Product, error) {
+// WithContext scopes the repository to a request, so its queries are traced
+// as part of the request and stop when the client goes away. In Transactional
+// handlers they run in the request's transaction.
+func (repo *GenericRepository) WithContext(ctx context.Context) *GenericRepository {
+	if tx := transactionFromContext(ctx); tx != nil {
+		return &GenericRepository{DB: tx.WithContext(ctx)}
+	}
+	return &GenericRepository{DB: repo.DB.WithContext(ctx)}
+}
+
+// listQuery filters the active products by opts, without ordering or paging
+func listQuery(db *gorm.DB, opts ListOptions) *gorm.DB {
+	return db.Model(&Product{}).Where("is_deleted = ?", false).Scopes(nameSearch(opts), inCategories(opts), priceRange(opts))
+}
+
+func (repo *GenericRepository) GetAll(opts ListOptions) ([]Product, int64, error) {
 	var products []Product
-	err := repo.DB.Where("is_deleted = ?", false).Find(&products).Error
+	var total int64
+	query := listQuery(repo.DB, opts)
+	err := query.Count(&total).Error
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
-	return products, nil
+	err = query.Scopes(ordered(opts), paginate(opts)).Find(&products).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return products, total, nil
 }
 
+// Concurrent reads of the same product share one query
+var productReads singleflight.Group
+
+// GetById joins an identical read already in flight instead of issuing its
+// own. The shared query ignores cancellation, otherwise the first client
+// hanging up would fail everyone waiting on it. Reads in a transaction can
+// see its uncommitted writes, so they are never shared.
 func (repo *GenericRepository) GetById(id uint) (*Product, error) {
-	var product Product
-	err := repo.DB.Where("id = ? AND is_deleted = ?", id, false).First(&product).Error
+	db := repo.DB.WithContext(context.WithoutCancel(repo.DB.Statement.Context))
+	read := func() (interface{}, error) {
+		var product Product
+		err := db.Where("id = ? AND is_deleted = ?", id, false).First(&product).Error
+		return product, err
+	}
+	var value interface{}
+	var err error
+	if _, inTransaction := repo.DB.Statement.ConnPool.(gorm.TxCommitter); inTransaction {
+		value, err = read()
+	} else {
+		value, err, _ = productReads.Do(strconv.FormatUint(uint64(id), 10), read)
+	}
 	if err != nil {
 		return nil, err
 	}
+	// Each caller gets its own copy to modify
+	product := value.(Product)
 	return &product, nil
 }
 
-func (repo *GenericRepository) Create(product *Product) (*Product, error) {
-	err := repo.DB.Create(product).Error
+// GetByIdWithDeleted also finds soft-deleted products
+func (repo *GenericRepository) GetByIdWithDeleted(id uint) (*Product, error) {
+	var product Product
+	err := repo.DB.Where("id = ?", id).First(&product).Error
 	if err != nil {
 		return nil, err
 	}
-	return product, nil
+	return &product, nil
 }
 
-func (repo *GenericRepository) Update(product *Product) (*Product, error) {
-	err := repo.DB.Save(product).Error
+// GetByIds loads several products in one query, keyed by id. Missing or
+// deleted ids are simply absent from the map.
+func (repo *GenericRepository) GetByIds(ids []uint) (map[uint]Product, error) {
+	products := make(map[uint]Product, len(ids))
+	if len(ids) == 0 {
+		return products, nil
+	}
+	var found []Product
+	err := repo.DB.Where("id IN ? AND is_deleted = ?", ids, false).Find(&found).Error
 	if err != nil {
 		return nil, err
 	}
+	for _, product := range found {
+		products[product.ID] = product
+	}
+	return products, nil
+}
+
+func (repo *GenericRepository) Create(product *Product) (*Product, error) {
+	if err := repo.checkConflicts(product); err != nil {
+		return nil, err
+	}
+	product.ViewCount = 0
+	product.DeletedReason = ""
+	err := repo.DB.Create(product).Error
+	if err != nil {
+		return nil, translateProductError(err)
+	}
 	return product, nil
 }
 
-func (repo *GenericRepository) Delete(id uint) (bool, error) {
-	var product Product
-	err := repo.DB.Where("id = ? AND is_deleted = ?", id, false).First(&product).Error
+// Update saves the product over the stored row and also returns the row as
+// it was before. Fields managed by the server are carried over from the
+// stored row. A missing product is gorm.ErrRecordNotFound, unless upsert is
+// set: then it's created with the given id and the previous row is nil.
+func (repo *GenericRepository) Update(product *Product, upsert bool, check func(stored *Product) error) (*Product, *Product, error) {
+	var previous *Product
+	err := repo.DB.Transaction(func(tx *gorm.DB) error {
+		var existing Product
+		err := tx.Where("id = ?", product.ID).First(&existing).Error
+		switch {
+		case err == nil && existing.IsDeleted:
+			// Upserting must not silently resurrect a deleted product
+			return ErrProductDeleted
+		case err == nil:
+			if err := check(&existing); err != nil {
+				return err
+			}
+			previous = &existing
+			product.CreatedAt = existing.CreatedAt
+			product.IsDeleted = existing.IsDeleted
+			product.DeletedAt = existing.DeletedAt
+			product.DeletedReason = existing.DeletedReason
+			product.ViewCount = existing.ViewCount
+		case errors.Is(err, gorm.ErrRecordNotFound) && upsert:
+			if err := check(nil); err != nil {
+				return err
+			}
+			product.IsDeleted = false
+			product.DeletedAt = nil
+			product.DeletedReason = ""
+			product.ViewCount = 0
+		default:
+			return err
+		}
+		txRepo := &GenericRepository{DB: tx}
+		if err := txRepo.checkConflicts(product); err != nil {
+			return err
+		}
+		return translateProductError(tx.Save(product).Error)
+	})
 	if err != nil {
-		return false, err
+		return nil, nil, err
+	}
+	return product, previous, nil
+}
+
+// checkConflicts enforces the uniqueness rules among active products:
+// SKUs are unique, and names are unique per category ignoring case.
+// Soft-deleted products are ignored so their SKUs and names can be recycled.
+func (repo *GenericRepository) checkConflicts(product *Product) error {
+	if product.SKU != "" {
+		var count int64
+		err := repo.DB.Model(&Product{}).
+			Where("sku = ? AND is_deleted = ? AND id <> ?", product.SKU, false, product.ID).
+			Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrDuplicateSKU
+		}
+	}
+	// Checked here rather than with a unique index because existing catalogs
+	// may already contain duplicates, which would make the index fail to build
+	if product.CategoryID != nil {
+		var count int64
+		err := repo.DB.Model(&Product{}).
+			Where("LOWER(name) = LOWER(?) AND category_id = ? AND is_deleted = ? AND id <> ?", product.Name, *product.CategoryID, false, product.ID).
+			Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrDuplicateName
+		}
+	}
+	return nil
+}
+
+// The unique index is the last line of defense against concurrent inserts
+func translateProductError(err error) error {
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrDuplicateSKU
+	}
+	return err
+}
+
+// Delete only writes the deletion columns, so stock or price changes
+// committed meanwhile aren't written back over, nor recorded again by the
+// save hooks
+func (repo *GenericRepository) Delete(id uint, reason string) (bool, error) {
+	now := time.Now().UTC()
+	result := repo.DB.Model(&Product{}).Where("id = ? AND is_deleted = ?", id, false).
+		UpdateColumns(map[string]interface{}{"is_deleted": true, "deleted_at": now, "deleted_reason": reason, "updated_at": now})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, gorm.ErrRecordNotFound
 	}
-	product.IsDeleted = true
-	repo.DB.Save(&product)
 	return true, nil
 }
 
@@ -96,13 +379,40 @@ var productRepo *GenericRepository
 
 // Handlers
 func GetAllProducts(w http.ResponseWriter, r *http.Request) {
-	products, err := productRepo.GetAll()
+	params := NewQueryParams(r)
+	opts := parseProductListOptions(params)
+	include := params.Values("include", productIncludes)
+	explain := config.Debug && params.Bool("explain", false)
+	if !params.Valid() {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid query parameters", params.Errors)
+		return
+	}
+	if errs := marginForbidden(r); include["margin"] && len(errs) > 0 {
+		respondWithError(w, r, http.StatusForbidden, "Forbidden", errs)
+		return
+	}
+	if explain {
+		explainProducts(w, r, opts)
+		return
+	}
+	products, total, err := productStore(r.Context()).GetAll(opts)
 	if err != nil {
 		http.Error(w, "Error fetching products", http.StatusInternalServerError)
 		return
 	}
-	response := ApiResponse{Success: true, Data: products, Message: "Products retrieved successfully"}
-	respondWithJSON(w, response)
+	if err := localize(w, r, productPointers(products)...); err != nil {
+		http.Error(w, "Error fetching products", http.StatusInternalServerError)
+		return
+	}
+	var data interface{} = products
+	if len(include) > 0 {
+		if data, err = productViews(r, products, include); err != nil {
+			http.Error(w, "Error fetching products", http.StatusInternalServerError)
+			return
+		}
+	}
+	meta := newPageMeta(opts, total, len(products))
+	respondWithPage(w, r, data, "Products retrieved successfully", meta)
 }
 
 func GetProductById(w http.ResponseWriter, r *http.Request) {
@@ -114,40 +424,168 @@ func GetProductById(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid product ID", http.StatusBadRequest)
 		return
 	}
-	product, err := productRepo.GetById(uint(productID))
+	params := NewQueryParams(r)
+	showDeleted := params.Bool("show_deleted", false)
+	include := params.Values("include", productIncludes)
+	currencies := requestCurrencies(params)
+	if !params.Valid() {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid query parameters", params.Errors)
+		return
+	}
+	if errs := marginForbidden(r); include["margin"] && len(errs) > 0 {
+		respondWithError(w, r, http.StatusForbidden, "Forbidden", errs)
+		return
+	}
+	if showDeleted {
+		getDeletedProduct(w, r, uint(productID))
+		return
+	}
+	if expand := params.values.Get("expand"); expand != "" {
+		getExpandedProduct(w, r, uint(productID), expand)
+		return
+	}
+	product, err := productStore(r.Context()).GetById(uint(productID))
 	if err != nil {
 		http.Error(w, "Product not found", http.StatusNotFound)
 		return
 	}
-	response := ApiResponse{Success: true, Data: product, Message: "Product retrieved successfully"}
-	respondWithJSON(w, response)
+	if err := localize(w, r, product); err != nil {
+		http.Error(w, "Error fetching product", http.StatusInternalServerError)
+		return
+	}
+	view := ProductView{Product: product}
+	if include["margin"] {
+		view.ProductMargin = product.margin()
+	}
+	var warnings []string
+	if include["sale"] {
+		if view.SaleStatus, err = saleStatus(r, product); err != nil {
+			http.Error(w, "Error fetching product", http.StatusInternalServerError)
+			return
+		}
+	}
+	if len(currencies) > 0 {
+		view.CurrencyPrices, warnings, err = productRepo.WithContext(r.Context()).ConvertPrice(product.Price, currencies)
+		if err != nil {
+			http.Error(w, "Error converting prices", http.StatusInternalServerError)
+			return
+		}
+	}
+	// Sales end and rates change without the product changing, so only the
+	// plain product can be revalidated
+	if view.SaleStatus == nil && view.CurrencyPrices == nil && notModified(w, r, localizedModTime(r, product)) {
+		return
+	}
+	response := ApiResponse{Success: true, Data: view, Message: "Product retrieved successfully", Warnings: warnings}
+	respondWithJSON(w, r, response)
+}
+
+// ProductView is a product with the extras the request asked for; the ones
+// not asked for are nil and left out
+type ProductView struct {
+	*Product
+	*SaleStatus
+	*CurrencyPrices
+	*ProductMargin
+}
+
+// productViews adds the extras in include to a product list
+func productViews(r *http.Request, products []Product, include map[string]bool) ([]ProductView, error) {
+	views := make([]ProductView, len(products))
+	for i := range products {
+		views[i].Product = &products[i]
+		if include["margin"] {
+			views[i].ProductMargin = products[i].margin()
+		}
+	}
+	if include["sale"] {
+		sale, err := listWithSaleStatus(r, products)
+		if err != nil {
+			return nil, err
+		}
+		for i := range sale {
+			views[i].SaleStatus = &sale[i].SaleStatus
+		}
+	}
+	return views, nil
+}
+
+// DeletedProduct marks a soft-deleted product returned by show_deleted
+type DeletedProduct struct {
+	*Product
+	Deleted bool `json:"deleted"`
+}
+
+// getDeletedProduct lets admins see soft-deleted products, so a deleted
+// product can be told apart from one that never existed
+func getDeletedProduct(w http.ResponseWriter, r *http.Request, id uint) {
+	if !isAdmin(r) {
+		respondWithError(w, r, http.StatusUnauthorized, "Unauthorized", []string{"show_deleted requires the admin token"})
+		return
+	}
+	product, err := productRepo.WithContext(r.Context()).GetByIdWithDeleted(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error fetching product", http.StatusInternalServerError)
+		return
+	}
+	if !product.IsDeleted {
+		response := ApiResponse{Success: true, Data: product, Message: "Product retrieved successfully"}
+		respondWithJSON(w, r, response)
+		return
+	}
+	response := ApiResponse{Success: true, Data: DeletedProduct{Product: product, Deleted: true}, Message: "Product is deleted"}
+	respondWithJSON(w, r, response)
 }
 
 func CreateProduct(w http.ResponseWriter, r *http.Request) {
 	var product Product
-	decoder := json.NewDecoder(r.Body)
-	err := decoder.Decode(&product)
+	fields, err := decodeBodyFields(r, &product)
 	if err != nil {
-		http.Error(w, "Invalid input", http.StatusBadRequest)
+		respondWithError(w, r, http.StatusBadRequest, "Invalid input", []string{err.Error()})
+		return
+	}
+	if errs := product.Validate(); len(errs) > 0 {
+		respondWithValidationErrors(w, r, errs)
+		return
+	}
+	if errs := checkFieldPermissions(r.Context(), fields, &product, nil); len(errs) > 0 {
+		respondWithError(w, r, http.StatusForbidden, "Forbidden", errs)
+		return
+	}
+	createdProduct, err := productStore(r.Context()).Create(&product)
+	if message := conflictMessage(err); message != "" {
+		http.Error(w, message, http.StatusConflict)
 		return
 	}
-	createdProduct, err := productRepo.Create(&product)
 	if err != nil {
 		http.Error(w, "Error creating product", http.StatusInternalServerError)
 		return
 	}
+	emitEvent(r.Context(), EventProductCreated, createdProduct)
 	response := ApiResponse{Success: true, Data: createdProduct, Message: "Product created successfully"}
-	respondWithJSON(w, response)
+	respondWithJSON(w, r, response)
 }
 
+// Errors of UpdateProduct's checks of the stored product
+var (
+	errUpdateForbidden = errors.New("update sets fields the caller can't change")
+	errModifiedSince   = errors.New("product was modified since If-Unmodified-Since")
+)
+
+// UpdateProduct replaces a product. Clients that manage their own ids can send
+// "Allow-Upsert: true" to create the product at that id when it doesn't
+// exist (answered with 201); without the header a missing product is a 404.
 func UpdateProduct(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 	var product Product
-	decoder := json.NewDecoder(r.Body)
-	err := decoder.Decode(&product)
+	fields, err := decodeBodyFields(r, &product)
 	if err != nil {
-		http.Error(w, "Invalid input", http.StatusBadRequest)
+		respondWithError(w, r, http.StatusBadRequest, "Invalid input", []string{err.Error()})
 		return
 	}
 	// Convert string id to uint
@@ -157,13 +595,80 @@ func UpdateProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	product.ID = uint(productID)
-	updatedProduct, err := productRepo.Update(&product)
+	if errs := product.Validate(); len(errs) > 0 {
+		respondWithValidationErrors(w, r, errs)
+		return
+	}
+	var since time.Time
+	if header := r.Header.Get("If-Unmodified-Since"); header != "" {
+		if since, err = http.ParseTime(header); err != nil {
+			http.Error(w, "Invalid If-Unmodified-Since header", http.StatusBadRequest)
+			return
+		}
+	}
+	// Checked against the row the update replaces, so there's a single read
+	var forbidden []string
+	check := func(stored *Product) error {
+		if forbidden = checkFieldPermissions(r.Context(), fields, &product, stored); len(forbidden) > 0 {
+			return errUpdateForbidden
+		}
+		if since.IsZero() {
+			return nil
+		}
+		if stored == nil {
+			return gorm.ErrRecordNotFound
+		}
+		// HTTP dates carry whole seconds only
+		if stored.UpdatedAt.Truncate(time.Second).After(since) {
+			return errModifiedSince
+		}
+		return nil
+	}
+	upsert, _ := strconv.ParseBool(r.Header.Get("Allow-Upsert"))
+	updatedProduct, previousProduct, err := productStore(r.Context()).Update(&product, upsert, check)
+	if errors.Is(err, errUpdateForbidden) {
+		respondWithError(w, r, http.StatusForbidden, "Forbidden", forbidden)
+		return
+	}
+	if errors.Is(err, errModifiedSince) {
+		http.Error(w, "Product was modified since the given date", http.StatusPreconditionFailed)
+		return
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, ErrProductDeleted) {
+		http.Error(w, "Product is deleted, restore it before updating", http.StatusConflict)
+		return
+	}
+	if message := conflictMessage(err); message != "" {
+		http.Error(w, message, http.StatusConflict)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Error updating product", http.StatusInternalServerError)
 		return
 	}
-	response := ApiResponse{Success: true, Data: updatedProduct, Message: "Product updated successfully"}
-	respondWithJSON(w, response)
+	if previousProduct == nil {
+		emitEvent(r.Context(), EventProductCreated, updatedProduct)
+		response := ApiResponse{Success: true, Data: updatedProduct, Message: "Product created successfully"}
+		respondWithJSONStatus(w, r, http.StatusCreated, response)
+		return
+	}
+	emitEvent(r.Context(), EventProductUpdated, updatedProduct)
+	var data interface{} = updatedProduct
+	if r.URL.Query().Get("return") == "diff" {
+		data = UpdateResult{Previous: previousProduct, Current: updatedProduct}
+	}
+	response := ApiResponse{Success: true, Data: data, Message: "Product updated successfully"}
+	respondWithJSON(w, r, response)
+}
+
+// UpdateResult is returned by PUT when the client asks for ?return=diff
+type UpdateResult struct {
+	Previous *Product `json:"previous"`
+	Current  *Product `json:"current"`
 }
 
 func DeleteProduct(w http.ResponseWriter, r *http.Request) {
@@ -175,7 +680,24 @@ func DeleteProduct(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid product ID", http.StatusBadRequest)
 		return
 	}
-	success, err := productRepo.Delete(uint(productID))
+	// The body is optional; older clients send none
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	if err := decodeBody(r, &body); err != nil && !errors.Is(err, io.EOF) {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid input", []string{err.Error()})
+		return
+	}
+	reason := strings.TrimSpace(body.Reason)
+	if len(reason) > maxDeletedReasonLength {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid input", []string{fmt.Sprintf("reason must be at most %d characters", maxDeletedReasonLength)})
+		return
+	}
+	success, err := productStore(r.Context()).Delete(uint(productID), reason)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Error deleting product", http.StatusInternalServerError)
 		return
@@ -184,37 +706,343 @@ func DeleteProduct(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Product not found", http.StatusNotFound)
 		return
 	}
+	emitEvent(r.Context(), EventProductDeleted, map[string]uint{"id": uint(productID)})
 	response := ApiResponse{Success: true, Message: "Product deleted successfully"}
-	respondWithJSON(w, response)
+	respondWithJSON(w, r, response)
+}
+
+// conflictMessage describes a uniqueness violation or a write conflicting
+// with stored state, or returns "" for other errors
+func conflictMessage(err error) string {
+	switch {
+	case errors.Is(err, ErrStockBelowWarehouses):
+		return "Stock quantity is below the stock held in warehouses"
+	case errors.Is(err, ErrDuplicateSKU):
+		return "A product with this SKU already exists"
+	case errors.Is(err, ErrDuplicateName):
+		return "A product with this name already exists in the category"
+	}
+	return ""
+}
+
+// decodeBody decodes a JSON request body. STRICT_DECODE rejects unknown
+// fields, which catches typos like "prce" early, but then any field a newer
+// client sends breaks older servers, so it's meant for development. Lenient
+// decoding silently ignores what it doesn't know.
+func decodeBody(r *http.Request, v interface{}) error {
+	return newDecoder(r.Body).Decode(v)
 }
 
-func respondWithJSON(w http.ResponseWriter, response ApiResponse) {
+// decodeJSON is decodeBody for a body that was already read
+func decodeJSON(data []byte, v interface{}) error {
+	return newDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// newDecoder returns a JSON decoder that honors STRICT_DECODE
+func newDecoder(body io.Reader) *json.Decoder {
+	decoder := json.NewDecoder(body)
+	if config.StrictDecode {
+		decoder.DisallowUnknownFields()
+	}
+	return decoder
+}
+
+// decodeBodyFields decodes a JSON object body like decodeBody and also
+// returns the names of the fields it set
+func decodeBodyFields(r *http.Request, v interface{}) (map[string]bool, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err := decodeBody(r, v); err != nil {
+		return nil, err
+	}
+	return jsonFields(body)
+}
+
+// decodeBodyItemFields is decodeBodyFields for an array body, returning the
+// fields set by each item
+func decodeBodyItemFields(r *http.Request, v interface{}) ([]map[string]bool, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err := decodeBody(r, v); err != nil {
+		return nil, err
+	}
+	var items []json.RawMessage
+	if err := json.Unmarshal(body, &items); err != nil {
+		return nil, err
+	}
+	fields := make([]map[string]bool, len(items))
+	for i, item := range items {
+		if fields[i], err = jsonFields(item); err != nil {
+			return nil, err
+		}
+	}
+	return fields, nil
+}
+
+// jsonFields returns the top-level field names of a JSON object
+func jsonFields(data []byte) (map[string]bool, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	fields := make(map[string]bool, len(raw))
+	for name := range raw {
+		fields[name] = true
+	}
+	return fields, nil
+}
+
+func respondWithJSON(w http.ResponseWriter, r *http.Request, response ApiResponse) {
+	respondWithJSONStatus(w, r, http.StatusOK, response)
+}
+
+func respondWithJSONStatus(w http.ResponseWriter, r *http.Request, status int, response ApiResponse) {
+	if wantsRaw(r) {
+		if response.Data == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeJSON(w, r, status, response.Data)
+		return
+	}
+	response.Warnings = append(response.Warnings, deprecationWarnings(r)...)
+	writeJSON(w, r, status, response)
+}
+
+type rawError struct {
+	Error   string   `json:"error"`
+	Details []string `json:"details,omitempty"`
+}
+
+func respondWithError(w http.ResponseWriter, r *http.Request, status int, message string, errs []string) {
+	if wantsRaw(r) {
+		writeJSON(w, r, status, rawError{Error: message, Details: errs})
+		return
+	}
+	response := ApiResponse{Success: false, Message: message, Errors: errs, Warnings: deprecationWarnings(r)}
+	writeJSON(w, r, status, response)
+}
+
+// respondWithValidationErrors reports a well-formed body that breaks the
+// business rules. Bodies that can't be decoded at all stay a 400.
+func respondWithValidationErrors(w http.ResponseWriter, r *http.Request, errs []string) {
+	respondWithError(w, r, http.StatusUnprocessableEntity, "Invalid product", errs)
+}
+
+// Clients opt out of the ApiResponse envelope with the X-Raw-Response header
+// or ?envelope=false
+func wantsRaw(r *http.Request) bool {
+	if raw, _ := strconv.ParseBool(r.Header.Get("X-Raw-Response")); raw {
+		return true
+	}
+	envelope, err := strconv.ParseBool(r.URL.Query().Get("envelope"))
+	return err == nil && !envelope
+}
+
+// writeJSON marshals the whole payload before writing it, so Content-Length is
+// always exact whether the output is compact or indented.
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, payload interface{}) {
+	var body []byte
+	var err error
+	if wantsPretty(r) {
+		body, err = json.MarshalIndent(payload, "", "  ")
+	} else {
+		body, err = json.Marshal(payload)
+	}
+	if err != nil {
+		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+		return
+	}
+	body = append(inRequestTimezone(r, withoutRestrictedFields(r, body)), '\n')
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// Pretty output is enabled globally by config or per request with ?pretty=true
+func wantsPretty(r *http.Request) bool {
+	if config.Pretty {
+		return true
+	}
+	pretty, _ := strconv.ParseBool(r.URL.Query().Get("pretty"))
+	return pretty
 }
 
 // Setup routes
 func InitializeRoutes() {
 	r := mux.NewRouter()
+	r.Use(TracingMiddleware)
+	r.Use(RateLimitMiddleware)
+	r.Use(TimeoutMiddleware)
+	r.Use(CircuitBreakerMiddleware)
+	r.Use(AuthenticateUser)
+	r.Use(ReadOnlyMiddleware)
+	r.Use(CacheMiddleware)
+	r.Use(DeprecationMiddleware)
+	r.Use(TimezoneMiddleware)
+	r.HandleFunc("/livez", Livez).Methods("GET")
+	r.HandleFunc("/readyz", Readyz).Methods("GET")
 	r.HandleFunc("/products", GetAllProducts).Methods("GET")
+	r.HandleFunc("/products/by-category", GetProductsByCategory).Methods("GET")
+	r.HandleFunc("/products/schema", GetProductSchema).Methods("GET")
+	r.HandleFunc("/products/export", ExportProducts).Methods("GET")
+	r.HandleFunc("/products/stream-import", StreamImportProducts).Methods("POST")
+	r.HandleFunc("/products/reorder-suggestions", GetReorderSuggestions).Methods("GET")
+	r.HandleFunc("/products/extremes", GetProductExtremes).Methods("GET")
+	r.HandleFunc("/products/facets/{field}", GetProductFacets).Methods("GET")
+	r.HandleFunc("/products/stats/daily", GetDailyStats).Methods("GET")
+	r.HandleFunc("/products/recent-changes", GetRecentChanges).Methods("GET")
+	r.HandleFunc("/products/issues", GetProductIssues).Methods("GET")
+	r.HandleFunc("/products/random", GetRandomProducts).Methods("GET")
+	r.HandleFunc("/products/duplicates", GetDuplicateProducts).Methods("GET")
+	r.HandleFunc("/products/feed.xml", Feature("atom_feed", GetProductFeed)).Methods("GET")
+	r.HandleFunc("/sitemap.xml", GetSitemap).Methods("GET")
+	r.HandleFunc("/products/summary", GetProductSummaries).Methods("GET")
+	r.HandleFunc("/products/deleted", RequireAdmin(GetDeletedProducts)).Methods("GET")
+	r.HandleFunc("/products/search", SearchProducts).Methods("GET")
+	r.HandleFunc("/products/compare", GetProductComparison).Methods("GET")
+	r.HandleFunc("/products/stock/batch", Transactional(AdjustStockBatch)).Methods("POST")
+	r.HandleFunc("/products/restore", Transactional(RestoreProducts)).Methods("POST")
+	r.HandleFunc("/products/upsert", Feature("bulk_upsert", Transactional(UpsertProducts))).Methods("POST")
+	r.HandleFunc("/products/merge", Feature("product_merge", Transactional(MergeProducts))).Methods("POST")
+	r.HandleFunc("/products/tags/bulk", BulkTagProducts).Methods("POST")
 	r.HandleFunc("/products/{id}", GetProductById).Methods("GET")
-	r.HandleFunc("/products", CreateProduct).Methods("POST")
-	r.HandleFunc("/products/{id}", UpdateProduct).Methods("PUT")
-	r.HandleFunc("/products/{id}", DeleteProduct).Methods("DELETE")
-	http.Handle("/", r)
+	r.HandleFunc("/products", Transactional(CreateProduct)).Methods("POST")
+	r.HandleFunc("/products/validate", ValidateProduct).Methods("POST")
+	r.HandleFunc("/products/{id}", Transactional(UpdateProduct)).Methods("PUT")
+	r.HandleFunc("/products/{id}", Transactional(DeleteProduct)).Methods("DELETE")
+	r.HandleFunc("/products/{id}", Transactional(PatchProduct)).Methods("PATCH")
+	r.HandleFunc("/products/{id}/full", GetProductDetails).Methods("GET")
+	r.HandleFunc("/products/{id}/availability", GetProductAvailability).Methods("GET")
+	r.HandleFunc("/products/{id}/warehouses", GetProductWarehouses).Methods("GET")
+	r.HandleFunc("/products/{id}/stock-history", GetProductStockHistory).Methods("GET")
+	r.HandleFunc("/products/{id}/images/order", ReorderProductImages).Methods("PUT")
+	r.HandleFunc("/products/{id}/similar", GetSimilarProducts).Methods("GET")
+	r.HandleFunc("/products/{id}/frequently-bought-with", GetFrequentlyBoughtWith).Methods("GET")
+	r.HandleFunc("/products/{id}/move", Transactional(MoveProduct)).Methods("POST")
+	r.HandleFunc("/products/{id}/view", RecordProductView).Methods("POST")
+	r.HandleFunc("/products/{id}/reserve", ReserveStock).Methods("POST")
+	r.HandleFunc("/products/{id}/audit", RequireAdmin(GetProductAudit)).Methods("GET")
+	r.HandleFunc("/products/{id}/price", GetProductPrice).Methods("GET")
+	r.HandleFunc("/products/{id}/tiers", GetProductTiers).Methods("GET")
+	r.HandleFunc("/products/{id}/tiers", CreateProductTier).Methods("POST")
+	r.HandleFunc("/products/{id}/tiers/{tierId}", UpdateProductTier).Methods("PUT")
+	r.HandleFunc("/products/{id}/tiers/{tierId}", DeleteProductTier).Methods("DELETE")
+	r.HandleFunc("/products/{id}/translations", GetProductTranslations).Methods("GET")
+	r.HandleFunc("/products/{id}/translations/{locale}", PutProductTranslation).Methods("PUT")
+	r.HandleFunc("/products/{id}/translations/{locale}", DeleteProductTranslation).Methods("DELETE")
+	r.HandleFunc("/categories", GetAllCategories).Methods("GET")
+	r.HandleFunc("/categories", CreateCategory).Methods("POST")
+	r.HandleFunc("/categories/{id}/children", GetCategoryChildren).Methods("GET")
+	r.HandleFunc("/categories/{id}/ancestors", GetCategoryAncestors).Methods("GET")
+	r.HandleFunc("/categories/{id}/products", GetCategoryProducts).Methods("GET")
+	r.HandleFunc("/categories/{id}/parent", SetCategoryParent).Methods("PUT")
+	r.HandleFunc("/admin/reindex", RequireAdmin(ReindexProducts)).Methods("POST")
+	r.HandleFunc("/admin/reencrypt", RequireAdmin(ReencryptProducts)).Methods("POST")
+	r.HandleFunc("/admin/verify", RequireAdmin(VerifyIntegrity)).Methods("POST")
+	r.HandleFunc("/admin/stats", RequireAdmin(GetRuntimeStats)).Methods("GET")
+	r.HandleFunc("/admin/currencies/{currency}", RequireAdmin(PutCurrencyRate)).Methods("PUT")
+	r.HandleFunc("/currencies", GetCurrencyRates).Methods("GET")
+	r.HandleFunc("/orders", RecordOrder).Methods("POST")
+	r.HandleFunc("/jobs/import", ImportProductsJob).Methods("POST")
+	r.HandleFunc("/jobs/{id}", GetJob).Methods("GET")
+	http.Handle("/", CountRequests(CORSMiddleware(r)))
 }
 
 func main() {
+	cloneTo := flag.String("clone-to", "", "copy the database to this DSN and exit")
+	configPath := flag.String("config", "", "YAML or JSON config file; environment variables override it")
+	flag.Parse()
+
+	// Load configuration
+	loaded, err := LoadConfig(*configPath)
+	if err != nil {
+		log.Fatal("Invalid configuration: ", err)
+	}
+	config = loaded
+	if err := config.Validate(); err != nil {
+		log.Fatal("Invalid configuration: ", err)
+	}
+	fieldKeys, _ = NewKeyring(config.FieldEncryptionKeys, config.FieldEncryptionKeyID)
+
+	// Log through slog, including the standard log package
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, nil)))
+	log.Printf("Default currency %s, default locale %s", config.DefaultCurrency, normalizeLocale(config.DefaultLocale))
+
+	// Initialize tracing
+	shutdownTracing, err := InitTracing(context.Background())
+	if err != nil {
+		log.Fatal("Error initializing tracing: ", err)
+	}
+
 	// Initialize DB
 	InitDb()
 
+	if *cloneTo != "" {
+		runClone(*cloneTo)
+		return
+	}
+
 	// Initialize repository
 	productRepo = &GenericRepository{DB: db}
+	categoryRepo = &CategoryRepository{DB: db}
 
 	// Initialize routes
 	InitializeRoutes()
 
+	// Start background jobs, stopped on shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	var jobs sync.WaitGroup
+	StartPurgeJob(ctx, &jobs, time.Duration(config.RetentionDays)*24*time.Hour)
+	StartLowStockJob(ctx, &jobs, config.LowStockThreshold, logAlerter{})
+	StartReservationJob(ctx, &jobs)
+	if sqlDB, err := db.DB(); err == nil {
+		StartDBWatchdog(ctx, &jobs, sqlDB)
+	}
+	// Publishers outlive the jobs, which emit events until they stop
+	var publishers sync.WaitGroup
+	webhooks = NewWebhookDispatcher(config.WebhookURLs)
+	webhooks.Start(&publishers)
+	if config.NATSURL != "" {
+		broker, err := NewNATSBroker(config.NATSURL)
+		if err != nil {
+			log.Fatal("Error connecting to NATS: ", err)
+		}
+		events = NewEventPublisher(broker, config.EventSubjectPrefix)
+		events.Start(&publishers)
+	}
+	jobQueue = NewJobQueue()
+	jobQueue.Start(ctx, &jobs)
+
 	// Start server
-	fmt.Println("Server is running on port 8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	server := &http.Server{Addr: ":8080"}
+	go func() {
+		fmt.Println("Server is running on port 8080")
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	<-ctx.Done()
+	fmt.Println("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Println("Error shutting down server: ", err)
+	}
+	jobs.Wait()
+	webhooks.Close()
+	events.Close()
+	publishers.Wait()
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		log.Println("Error flushing traces: ", err)
+	}
 }
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestMain(m *testing.M) {
+	loaded, err := LoadConfig("")
+	if err != nil {
+		panic(err)
+	}
+	config = loaded
+	os.Exit(m.Run())
+}
+
+// setupTestDB points the repositories at a fresh, migrated database that is
+// closed when the test ends
+func setupTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	database, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "product.db")), &gorm.Config{
+		TranslateError: true,
+		NowFunc:        utcNow,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrate(database); err != nil {
+		t.Fatal(err)
+	}
+	db = database
+	productRepo = &GenericRepository{DB: database}
+	categoryRepo = &CategoryRepository{DB: database}
+	t.Cleanup(func() {
+		if sqlDB, err := database.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return database
+}
+
+// serve calls a handler with a JSON body and the given route variables
+func serve(handler http.HandlerFunc, method, target string, body interface{}, vars map[string]string) *httptest.ResponseRecorder {
+	var payload bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&payload).Encode(body)
+	}
+	r := httptest.NewRequest(method, target, &payload)
+	r.Header.Set("Content-Type", "application/json")
+	if vars != nil {
+		r = mux.SetURLVars(r, vars)
+	}
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+// decodeProduct reads the product out of an ApiResponse body
+func decodeProduct(t *testing.T, w *httptest.ResponseRecorder) Product {
+	t.Helper()
+	var response struct {
+		Data Product `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decoding %q: %v", w.Body.String(), err)
+	}
+	return response.Data
+}
+
+func TestSKUConflictAndReuseAfterDelete(t *testing.T) {
+	setupTestDB(t)
+	product := map[string]interface{}{"name": "Widget", "sku": "W-1", "price": 5}
+
+	w := serve(CreateProduct, "POST", "/products", product, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("create: got %d: %s", w.Code, w.Body)
+	}
+	first := decodeProduct(t, w)
+	if w = serve(CreateProduct, "POST", "/products", map[string]interface{}{"name": "Other", "sku": "W-1", "price": 5}, nil); w.Code != http.StatusConflict {
+		t.Fatalf("duplicate SKU: got %d: %s", w.Code, w.Body)
+	}
+	// The partial index holds even for writes that skip checkConflicts
+	if err := db.Create(&Product{Name: "Raw", SKU: "W-1", Price: 5}).Error; !errors.Is(err, gorm.ErrDuplicatedKey) {
+		t.Fatalf("duplicate SKU insert: got %v", err)
+	}
+
+	id := strconv.Itoa(int(first.ID))
+	if w = serve(DeleteProduct, "DELETE", "/products/"+id, nil, map[string]string{"id": id}); w.Code != http.StatusOK {
+		t.Fatalf("delete: got %d: %s", w.Code, w.Body)
+	}
+	w = serve(CreateProduct, "POST", "/products", product, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("reuse after delete: got %d: %s", w.Code, w.Body)
+	}
+	if second := decodeProduct(t, w); second.ID == first.ID {
+		t.Fatal("reuse after delete: got the deleted product back")
+	}
+}
+
+func TestNameUniqueIgnoringCase(t *testing.T) {
+	setupTestDB(t)
+	tools, toys := Category{Name: "Tools"}, Category{Name: "Toys"}
+	if err := db.Create(&tools).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&toys).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	w := serve(CreateProduct, "POST", "/products", map[string]interface{}{"name": "Widget", "price": 5, "category_id": tools.ID}, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("create: got %d: %s", w.Code, w.Body)
+	}
+	w = serve(CreateProduct, "POST", "/products", map[string]interface{}{"name": "widget", "price": 5, "category_id": tools.ID}, nil)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("same name in another case: got %d: %s", w.Code, w.Body)
+	}
+	w = serve(CreateProduct, "POST", "/products", map[string]interface{}{"name": "widget", "price": 5, "category_id": toys.ID}, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("same name in another category: got %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestMigrateCreatesProductIndexes(t *testing.T) {
+	database := setupTestDB(t)
+	migrator := database.Migrator()
+	for _, field := range []string{"Price", "CategoryID", "IsDeleted", "CreatedAt", "UpdatedAt"} {
+		if !migrator.HasIndex(&Product{}, field) {
+			t.Errorf("no index on products.%s", field)
+		}
+	}
+	if !migrator.HasIndex(&Product{}, "idx_products_active_sku") {
+		t.Error("no partial index on active SKUs")
+	}
+}
+
+func TestMigrateNeverLowersSchemaVersion(t *testing.T) {
+	database := setupTestDB(t)
+	if err := database.Model(&SchemaMigration{}).Where("id = 1").Update("version", schemaVersion+1).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := migrate(database); err != nil {
+		t.Fatal(err)
+	}
+	if version, _ := migratedVersion(database); version != schemaVersion+1 {
+		t.Fatalf("older build rolled the version back to %d", version)
+	}
+
+	if err := database.Model(&SchemaMigration{}).Where("id = 1").Update("version", schemaVersion-1).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := migrate(database); err != nil {
+		t.Fatal(err)
+	}
+	if version, _ := migratedVersion(database); version != schemaVersion {
+		t.Fatalf("got version %d after migrating, want %d", version, schemaVersion)
+	}
+}
+
+func TestUpdateHonorsIfUnmodifiedSince(t *testing.T) {
+	setupTestDB(t)
+	w := serve(CreateProduct, "POST", "/products", map[string]interface{}{"name": "Widget", "sku": "W-1", "price": 5}, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("create: got %d: %s", w.Code, w.Body)
+	}
+	product := decodeProduct(t, w)
+	put := func(id uint, since time.Time, upsert bool) int {
+		target := "/products/" + strconv.Itoa(int(id))
+		body, _ := json.Marshal(map[string]interface{}{"name": "Gadget", "sku": "W-1", "price": 6})
+		r := httptest.NewRequest("PUT", target, bytes.NewReader(body))
+		r.Header.Set("If-Unmodified-Since", since.UTC().Format(http.TimeFormat))
+		if upsert {
+			r.Header.Set("Allow-Upsert", "true")
+		}
+		r = mux.SetURLVars(r, map[string]string{"id": strconv.Itoa(int(id))})
+		w := httptest.NewRecorder()
+		UpdateProduct(w, r)
+		return w.Code
+	}
+
+	if code := put(product.ID, product.UpdatedAt.Add(-time.Hour), false); code != http.StatusPreconditionFailed {
+		t.Fatalf("stale If-Unmodified-Since: got %d", code)
+	}
+	if stored, _ := productRepo.GetById(product.ID); stored.Name != "Widget" {
+		t.Fatalf("failed precondition still updated the product to %q", stored.Name)
+	}
+	if code := put(product.ID, product.UpdatedAt.Add(time.Hour), false); code != http.StatusOK {
+		t.Fatalf("current If-Unmodified-Since: got %d", code)
+	}
+	if code := put(product.ID+1, time.Now(), true); code != http.StatusNotFound {
+		t.Fatalf("If-Unmodified-Since on an upsert: got %d", code)
+	}
+}
+
+func TestDeleteOnlyWritesTheDeletionColumns(t *testing.T) {
+	setupTestDB(t)
+	product := Product{Name: "Widget", SKU: "W-1", Price: 5, StockQuantity: 3}
+	if err := db.Create(&product).Error; err != nil {
+		t.Fatal(err)
+	}
+	// Deleting must leave the stock as adjusted
+	if _, err := productRepo.AdjustStock(product.ID, 4, "restock"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := productRepo.Delete(product.ID, "discontinued"); !ok || err != nil {
+		t.Fatalf("delete: got %v, %v", ok, err)
+	}
+	stored, err := productRepo.GetByIdWithDeleted(product.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stored.IsDeleted || stored.DeletedAt == nil || stored.DeletedReason != "discontinued" || stored.StockQuantity != 7 {
+		t.Fatalf("deleted product: got %+v", stored)
+	}
+	if _, err := productRepo.Delete(product.ID, ""); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("deleting twice: got %v", err)
+	}
+
+	sqlDB, _ := db.DB()
+	sqlDB.Close()
+	if _, err := productRepo.Delete(product.ID, ""); err == nil || errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("delete on a closed database: got %v", err)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import "math"
+
+// marginSortExpression orders by (price - cost) / price. Products without a
+// cost or with a zero price have no margin and sort as NULL.
+const marginSortExpression = "CASE WHEN cost IS NOT NULL AND price > 0 THEN (price - cost) / price END"
+
+// ProductMargin is returned with products for ?include=margin
+type ProductMargin struct {
+	// Margin is the share of the price left after the cost, e.g. 0.25 for
+	// 25%; null when the product has no cost or no price
+	Margin *float64 `json:"margin"`
+}
+
+// marginValue computes the margin like marginSortExpression, unrounded
+func (product *Product) marginValue() (float64, bool) {
+	if product.Cost == nil || product.Price <= 0 {
+		return 0, false
+	}
+	return float64(product.Price-*product.Cost) / float64(product.Price), true
+}
+
+func (product *Product) margin() *ProductMargin {
+	value, ok := product.marginValue()
+	if !ok {
+		return &ProductMargin{}
+	}
+	margin := math.Round(value*10000) / 10000
+	return &ProductMargin{Margin: &margin}
+}
+
+// compareMargins orders products without a margin first, as SQLite sorts
+// NULLs
+func compareMargins(a, b *Product) int {
+	marginA, okA := a.marginValue()
+	marginB, okB := b.marginValue()
+	switch {
+	case !okA || !okB:
+		return compareOrdered(boolRank(okA), boolRank(okB))
+	case marginA < marginB:
+		return -1
+	case marginA > marginB:
+		return 1
+	}
+	return 0
+}
+
+func boolRank(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MemoryProductStore is a ProductStore backed by a map, for running the
+// handlers without a database. It follows the same rules as the GORM
+// repository: soft deletes and the uniqueness checks.
+type MemoryProductStore struct {
+	mu       sync.Mutex
+	products map[uint]Product
+	nextID   uint
+}
+
+func NewMemoryProductStore() *MemoryProductStore {
+	return &MemoryProductStore{products: map[uint]Product{}, nextID: 1}
+}
+
+func (store *MemoryProductStore) GetAll(opts ListOptions) ([]Product, int64, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	products := []Product{}
+	for _, product := range store.products {
+		if !product.IsDeleted && matchesListOptions(&product, opts) {
+			products = append(products, product)
+		}
+	}
+	sortProducts(products, opts.Order)
+	total := int64(len(products))
+	start := 0
+	if opts.PageSize > 0 {
+		start = (opts.Page - 1) * opts.PageSize
+	}
+	if start > len(products) {
+		start = len(products)
+	}
+	end := start + resultLimit(opts)
+	if end > len(products) {
+		end = len(products)
+	}
+	products = products[start:end]
+	return products, total, nil
+}
+
+func (store *MemoryProductStore) GetById(id uint) (*Product, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	product, ok := store.products[id]
+	if !ok || product.IsDeleted {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &product, nil
+}
+
+func (store *MemoryProductStore) GetByIds(ids []uint) (map[uint]Product, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	products := make(map[uint]Product, len(ids))
+	for _, id := range ids {
+		if product, ok := store.products[id]; ok && !product.IsDeleted {
+			products[id] = product
+		}
+	}
+	return products, nil
+}
+
+func (store *MemoryProductStore) Create(product *Product) (*Product, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.create(product)
+}
+
+// create stores a new product; the lock must be held
+func (store *MemoryProductStore) create(product *Product) (*Product, error) {
+	if err := store.checkConflicts(product); err != nil {
+		return nil, err
+	}
+	if product.ID == 0 {
+		product.ID = store.nextID
+	}
+	if product.ID >= store.nextID {
+		store.nextID = product.ID + 1
+	}
+	now := time.Now().UTC()
+	product.CreatedAt = now
+	product.UpdatedAt = now
+	product.IsDeleted = false
+	product.DeletedAt = nil
+	product.DeletedReason = ""
+	product.ViewCount = 0
+	store.products[product.ID] = *product
+	return product, nil
+}
+
+// Update holds the lock from the lookup to the write, so a concurrent
+// delete or conflicting create can't slip in between
+func (store *MemoryProductStore) Update(product *Product, upsert bool, check func(stored *Product) error) (*Product, *Product, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	existing, ok := store.products[product.ID]
+	switch {
+	case ok && existing.IsDeleted:
+		return nil, nil, ErrProductDeleted
+	case !ok && upsert:
+		if err := check(nil); err != nil {
+			return nil, nil, err
+		}
+		created, err := store.create(product)
+		return created, nil, err
+	case !ok:
+		return nil, nil, gorm.ErrRecordNotFound
+	}
+	if err := check(&existing); err != nil {
+		return nil, nil, err
+	}
+
+	if err := store.checkConflicts(product); err != nil {
+		return nil, nil, err
+	}
+	product.CreatedAt = existing.CreatedAt
+	product.UpdatedAt = time.Now().UTC()
+	product.IsDeleted = existing.IsDeleted
+	product.DeletedAt = existing.DeletedAt
+	product.DeletedReason = existing.DeletedReason
+	product.ViewCount = existing.ViewCount
+	store.products[product.ID] = *product
+	return product, &existing, nil
+}
+
+func (store *MemoryProductStore) Delete(id uint, reason string) (bool, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	product, ok := store.products[id]
+	if !ok || product.IsDeleted {
+		return false, gorm.ErrRecordNotFound
+	}
+	now := time.Now().UTC()
+	product.IsDeleted = true
+	product.DeletedAt = &now
+	product.DeletedReason = reason
+	store.products[id] = product
+	return true, nil
+}
+
+// checkConflicts mirrors GenericRepository.checkConflicts; the lock must be held
+func (store *MemoryProductStore) checkConflicts(product *Product) error {
+	for _, other := range store.products {
+		if other.IsDeleted || other.ID == product.ID {
+			continue
+		}
+		if product.SKU != "" && other.SKU == product.SKU {
+			return ErrDuplicateSKU
+		}
+		if product.CategoryID != nil && other.CategoryID != nil && *other.CategoryID == *product.CategoryID &&
+			strings.EqualFold(other.Name, product.Name) {
+			return ErrDuplicateName
+		}
+	}
+	return nil
+}
+
+func matchesListOptions(product *Product, opts ListOptions) bool {
+	if opts.Query != "" && !strings.Contains(strings.ToLower(product.Name), strings.ToLower(opts.Query)) {
+		return false
+	}
+	if opts.MinPrice != nil && float64(product.Price) < *opts.MinPrice {
+		return false
+	}
+	if opts.MaxPrice != nil && float64(product.Price) > *opts.MaxPrice {
+		return false
+	}
+	if len(opts.CategoryIDs) > 0 {
+		if product.CategoryID == nil {
+			return false
+		}
+		for _, id := range opts.CategoryIDs {
+			if id == *product.CategoryID {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// sortProducts applies a clause built by parseSort, like "price DESC, id ASC".
+// Without one the products are in id order, as the database would return them.
+func sortProducts(products []Product, order string) {
+	if order == "" {
+		order = "id ASC"
+	}
+	clauses := strings.Split(order, ",")
+	sort.SliceStable(products, func(i, j int) bool {
+		for _, clause := range clauses {
+			// Clauses end in their direction; computed fields have spaces
+			field, direction, _ := cutLast(strings.TrimSpace(clause), " ")
+			result := compareProductField(&products[i], &products[j], field)
+			if direction == "DESC" {
+				result = -result
+			}
+			if result != 0 {
+				return result < 0
+			}
+		}
+		return false
+	})
+}
+
+func compareProductField(a, b *Product, field string) int {
+	switch field {
+	case "name":
+		return strings.Compare(a.Name, b.Name)
+	case "price":
+		return compareOrdered(a.Price, b.Price)
+	case "stock_quantity":
+		return compareOrdered(a.StockQuantity, b.StockQuantity)
+	case "view_count":
+		return compareOrdered(a.ViewCount, b.ViewCount)
+	case "created_at":
+		return a.CreatedAt.Compare(b.CreatedAt)
+	case "updated_at":
+		return a.UpdatedAt.Compare(b.UpdatedAt)
+	case marginSortExpression:
+		return compareMargins(a, b)
+	default:
+		return compareOrdered(a.ID, b.ID)
+	}
+}
+
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+func compareOrdered[T int | uint | Price](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
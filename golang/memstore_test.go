@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+// useMemoryStore runs the product handlers against a MemoryProductStore for
+// the rest of the test. The audit trail still needs a database.
+func useMemoryStore(t *testing.T) *MemoryProductStore {
+	t.Helper()
+	setupTestDB(t)
+	store := NewMemoryProductStore()
+	previous := productStore
+	productStore = func(ctx context.Context) ProductStore { return store }
+	t.Cleanup(func() { productStore = previous })
+	return store
+}
+
+func TestProductHandlersWithMemoryStore(t *testing.T) {
+	store := useMemoryStore(t)
+
+	w := serve(CreateProduct, "POST", "/products", map[string]interface{}{"name": "Widget", "sku": "W-1", "price": 9.5, "stock_quantity": 3}, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("create: got %d: %s", w.Code, w.Body)
+	}
+	created := decodeProduct(t, w)
+	if created.ID == 0 {
+		t.Fatal("create: no id assigned")
+	}
+	id := strconv.Itoa(int(created.ID))
+	vars := map[string]string{"id": id}
+
+	w = serve(GetProductById, "GET", "/products/"+id, nil, vars)
+	if w.Code != http.StatusOK {
+		t.Fatalf("get: got %d: %s", w.Code, w.Body)
+	}
+	if got := decodeProduct(t, w); got.Name != "Widget" || got.Price != 9.5 {
+		t.Fatalf("get: got %+v", got)
+	}
+
+	w = serve(UpdateProduct, "PUT", "/products/"+id, map[string]interface{}{"name": "Gadget", "sku": "W-1", "price": 12, "stock_quantity": 3}, vars)
+	if w.Code != http.StatusOK {
+		t.Fatalf("update: got %d: %s", w.Code, w.Body)
+	}
+	if got, _ := store.GetById(created.ID); got.Name != "Gadget" || got.CreatedAt != created.CreatedAt {
+		t.Fatalf("update: stored %+v", got)
+	}
+
+	w = serve(DeleteProduct, "DELETE", "/products/"+id, nil, vars)
+	if w.Code != http.StatusOK {
+		t.Fatalf("delete: got %d: %s", w.Code, w.Body)
+	}
+	if w = serve(GetProductById, "GET", "/products/"+id, nil, vars); w.Code != http.StatusNotFound {
+		t.Fatalf("get deleted: got %d", w.Code)
+	}
+	if w = serve(DeleteProduct, "DELETE", "/products/"+id, nil, vars); w.Code != http.StatusNotFound {
+		t.Fatalf("delete twice: got %d", w.Code)
+	}
+	w = serve(UpdateProduct, "PUT", "/products/"+id, map[string]interface{}{"name": "Gadget", "price": 12}, vars)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("update deleted: got %d", w.Code)
+	}
+}
+
+func TestMemoryStoreUpdateConflicts(t *testing.T) {
+	useMemoryStore(t)
+
+	for _, sku := range []string{"A-1", "B-1"} {
+		if w := serve(CreateProduct, "POST", "/products", map[string]interface{}{"name": sku, "sku": sku, "price": 1}, nil); w.Code != http.StatusOK {
+			t.Fatalf("create %s: got %d: %s", sku, w.Code, w.Body)
+		}
+	}
+	w := serve(UpdateProduct, "PUT", "/products/2", map[string]interface{}{"name": "B", "sku": "A-1", "price": 1}, map[string]string{"id": "2"})
+	if w.Code != http.StatusConflict {
+		t.Fatalf("update to a taken SKU: got %d: %s", w.Code, w.Body)
+	}
+	w = serve(UpdateProduct, "PUT", "/products/9", map[string]interface{}{"name": "Missing", "price": 1}, map[string]string{"id": "9"})
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("update missing: got %d", w.Code)
+	}
+}
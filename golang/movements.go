@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// StockMovement is one entry of a product's stock ledger. Quantity is the
+// product's total stock after the change.
+type StockMovement struct {
+	ID          uint      `json:"id"`
+	ProductID   uint      `json:"product_id" gorm:"index"`
+	Delta       int       `json:"delta"`
+	Reason      string    `json:"reason"`
+	Quantity    int       `json:"quantity"`
+	WarehouseID string    `json:"warehouse_id,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+const maxMovementReasonLength = 200
+
+// Reasons recorded for stock set through the product itself
+const (
+	movementReasonCreated = "product created"
+	movementReasonUpdated = "product updated"
+)
+
+// recordStockChange is the ledger half of Product.AfterSave: stock written
+// with the product, on create or update, is recorded as the difference
+// from the last entry
+func (product *Product) recordStockChange(tx *gorm.DB) error {
+	var last StockMovement
+	err := tx.Where("product_id = ?", product.ID).Order("id DESC").Limit(1).Find(&last).Error
+	if err != nil || last.Quantity == product.StockQuantity {
+		return err
+	}
+	reason := movementReasonUpdated
+	if last.ID == 0 {
+		reason = movementReasonCreated
+	}
+	return tx.Create(&StockMovement{
+		ProductID: product.ID,
+		Delta:     product.StockQuantity - last.Quantity,
+		Reason:    reason,
+		Quantity:  product.StockQuantity,
+	}).Error
+}
+
+// GetStockMovements returns a product's ledger newest first, so a list cut
+// at MAX_RESULTS keeps the latest movements
+func (repo *GenericRepository) GetStockMovements(productID uint, opts ListOptions) ([]StockMovement, int64, error) {
+	var total int64
+	query := repo.DB.Model(&StockMovement{}).Where("product_id = ?", productID)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	movements := []StockMovement{}
+	err := query.Order("id DESC").Scopes(paginate(opts)).Find(&movements).Error
+	return movements, total, err
+}
+
+// Handlers
+func GetProductStockHistory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	productID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+	params := NewQueryParams(r)
+	opts := ParseListOptions(params)
+	if !params.Valid() {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid query parameters", params.Errors)
+		return
+	}
+	repo := productRepo.WithContext(r.Context())
+	if _, err := repo.GetById(uint(productID)); err != nil {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+	movements, total, err := repo.GetStockMovements(uint(productID), opts)
+	if err != nil {
+		http.Error(w, "Error fetching stock history", http.StatusInternalServerError)
+		return
+	}
+	meta := newPageMeta(opts, total, len(movements))
+	respondWithPage(w, r, movements, "Stock history retrieved successfully", meta)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestStockHistoryKeepsTheNewestMovements(t *testing.T) {
+	setupTestDB(t)
+	previous := config.MaxResults
+	config.MaxResults = 3
+	t.Cleanup(func() { config.MaxResults = previous })
+
+	product := Product{Name: "Widget", Price: 5}
+	if err := db.Create(&product).Error; err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 5; i++ {
+		if _, err := productRepo.AdjustStock(product.ID, 1, "restock "+strconv.Itoa(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	id := strconv.Itoa(int(product.ID))
+	w := serve(GetProductStockHistory, "GET", "/products/"+id+"/stock-history", nil, map[string]string{"id": id})
+	if w.Code != http.StatusOK {
+		t.Fatalf("history: got %d: %s", w.Code, w.Body)
+	}
+	var response struct {
+		Data []StockMovement `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Data) != 3 || response.Data[0].Quantity != 5 || response.Data[2].Quantity != 3 {
+		t.Fatalf("capped history: got %+v", response.Data)
+	}
+}
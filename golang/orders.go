@@ -0,0 +1,180 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+const (
+	maxOrderItems              = 100
+	defaultBoughtTogetherLimit = 5
+	maxBoughtTogetherLimit     = 20
+)
+
+// OrderItem is a line of an order placed in the checkout system, recorded
+// here only to learn which products sell together. OrderID is the checkout's
+// own reference. Items outlive purged products, like the orders they're from.
+type OrderItem struct {
+	ID        uint      `json:"id"`
+	OrderID   string    `json:"order_id" gorm:"uniqueIndex:idx_order_product;not null"`
+	ProductID uint      `json:"product_id" gorm:"uniqueIndex:idx_order_product;index;not null"`
+	Quantity  int       `json:"quantity"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+var ErrOrderExists = errors.New("order already recorded")
+
+// RecordOrder stores the items of an order, which must all be active products
+func (repo *GenericRepository) RecordOrder(items []OrderItem) error {
+	return repo.DB.Transaction(func(tx *gorm.DB) error {
+		var exists int64
+		if err := tx.Model(&OrderItem{}).Where("order_id = ?", items[0].OrderID).Count(&exists).Error; err != nil {
+			return err
+		}
+		if exists > 0 {
+			return ErrOrderExists
+		}
+		ids := make([]uint, len(items))
+		for i, item := range items {
+			ids[i] = item.ProductID
+		}
+		products, err := (&GenericRepository{DB: tx}).GetByIds(ids)
+		if err != nil {
+			return err
+		}
+		if len(products) != len(ids) {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Create(&items).Error
+	})
+}
+
+// BoughtTogether is a product that shared Orders orders with another one
+type BoughtTogether struct {
+	Product
+	Orders int64 `json:"orders"`
+}
+
+// GetBoughtTogether ranks the active products by the number of orders they
+// appear in together with the given product
+func (repo *GenericRepository) GetBoughtTogether(productID uint, limit int) ([]BoughtTogether, error) {
+	var counts []struct {
+		ProductID uint
+		Orders    int64
+	}
+	err := repo.DB.Table("order_items AS mine").
+		Select("other.product_id, COUNT(DISTINCT other.order_id) AS orders").
+		Joins("JOIN order_items AS other ON other.order_id = mine.order_id AND other.product_id <> mine.product_id").
+		Joins("JOIN products ON products.id = other.product_id AND products.is_deleted = ?", false).
+		Where("mine.product_id = ?", productID).
+		Group("other.product_id").
+		Order("orders DESC, other.product_id").
+		Limit(limit).
+		Scan(&counts).Error
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uint, len(counts))
+	for i, count := range counts {
+		ids[i] = count.ProductID
+	}
+	products, err := repo.GetByIds(ids)
+	if err != nil {
+		return nil, err
+	}
+	together := []BoughtTogether{}
+	for _, count := range counts {
+		if product, ok := products[count.ProductID]; ok {
+			together = append(together, BoughtTogether{Product: product, Orders: count.Orders})
+		}
+	}
+	return together, nil
+}
+
+type orderRequest struct {
+	OrderID string      `json:"order_id"`
+	Items   []OrderItem `json:"items"`
+}
+
+// Handlers
+func RecordOrder(w http.ResponseWriter, r *http.Request) {
+	var request orderRequest
+	if err := decodeBody(r, &request); err != nil {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid input", []string{err.Error()})
+		return
+	}
+	request.OrderID = strings.TrimSpace(request.OrderID)
+	var errs []string
+	if request.OrderID == "" {
+		errs = append(errs, "order_id is required")
+	}
+	if len(request.Items) == 0 || len(request.Items) > maxOrderItems {
+		errs = append(errs, fmt.Sprintf("items must contain between 1 and %d products", maxOrderItems))
+	}
+	seen := map[uint]bool{}
+	for i := range request.Items {
+		item := &request.Items[i]
+		if item.Quantity < 1 {
+			errs = append(errs, fmt.Sprintf("item %d: quantity must be at least 1", i))
+		}
+		if seen[item.ProductID] {
+			errs = append(errs, fmt.Sprintf("item %d: product %d is listed more than once", i, item.ProductID))
+		}
+		seen[item.ProductID] = true
+		item.ID = 0
+		item.OrderID = request.OrderID
+	}
+	if len(errs) > 0 {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid input", errs)
+		return
+	}
+	err := productRepo.WithContext(r.Context()).RecordOrder(request.Items)
+	if errors.Is(err, ErrOrderExists) {
+		http.Error(w, "Order already recorded", http.StatusConflict)
+		return
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		respondWithError(w, r, http.StatusUnprocessableEntity, "Invalid order", []string{"every item must be an existing product"})
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error recording order", http.StatusInternalServerError)
+		return
+	}
+	response := ApiResponse{Success: true, Data: request.Items, Message: "Order recorded successfully"}
+	respondWithJSONStatus(w, r, http.StatusCreated, response)
+}
+
+func GetFrequentlyBoughtWith(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	productID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+	params := NewQueryParams(r)
+	limit := params.Int("limit", defaultBoughtTogetherLimit, 1, maxBoughtTogetherLimit)
+	if !params.Valid() {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid query parameters", params.Errors)
+		return
+	}
+	repo := productRepo.WithContext(r.Context())
+	if _, err := repo.GetById(uint(productID)); err != nil {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+	products, err := repo.GetBoughtTogether(uint(productID), limit)
+	if err != nil {
+		http.Error(w, "Error fetching recommendations", http.StatusInternalServerError)
+		return
+	}
+	response := ApiResponse{Success: true, Data: products, Message: "Recommendations retrieved successfully"}
+	respondWithJSON(w, r, response)
+}
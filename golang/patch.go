@@ -0,0 +1,321 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// Fields a PATCH may change directly; the JSON names match the columns
+var patchableFields = map[string]bool{
+	"name":           true,
+	"sku":            true,
+	"price":          true,
+	"description":    true,
+	"stock_quantity": true,
+	"category_id":    true,
+	"supplier_cost":  true,
+	"reorder_point":  true,
+	"reorder_target": true,
+	"cost":           true,
+}
+
+// Fields managed by the server that a PATCH must never touch
+var protectedFields = map[string]bool{
+	"id":             true,
+	"created_at":     true,
+	"updated_at":     true,
+	"deleted_at":     true,
+	"deleted_reason": true,
+	"view_count":     true,
+}
+
+const maxDeletedReasonLength = 500
+
+// ErrNotDeleted is returned when restoring a product that isn't deleted
+var ErrNotDeleted = errors.New("product is not deleted")
+
+// Restore undoes a soft delete. The uniqueness rules are checked again since
+// another product may have taken the SKU or name in the meantime.
+func (repo *GenericRepository) Restore(id uint) (*Product, error) {
+	var product Product
+	err := repo.DB.Where("id = ?", id).First(&product).Error
+	if err != nil {
+		return nil, err
+	}
+	if !product.IsDeleted {
+		return nil, ErrNotDeleted
+	}
+	if err := repo.checkConflicts(&product); err != nil {
+		return nil, err
+	}
+	err = repo.DB.Model(&product).Select("is_deleted", "deleted_at", "deleted_reason").
+		Updates(map[string]interface{}{"is_deleted": false, "deleted_at": nil, "deleted_reason": ""}).Error
+	if err != nil {
+		return nil, translateProductError(err)
+	}
+	product.IsDeleted = false
+	product.DeletedAt = nil
+	product.DeletedReason = ""
+	return &product, nil
+}
+
+const maxRestoreBatchSize = 500
+
+type RestoreSkip struct {
+	ID     uint   `json:"id"`
+	Reason string `json:"reason"`
+}
+
+type RestoreBatchResult struct {
+	Restored []Product     `json:"restored"`
+	Skipped  []RestoreSkip `json:"skipped"`
+}
+
+// RestoreBatch restores each product in one transaction. Products that can't
+// be restored are skipped with a reason; only unexpected errors roll back.
+func (repo *GenericRepository) RestoreBatch(ids []uint) (*RestoreBatchResult, error) {
+	result := &RestoreBatchResult{Restored: []Product{}, Skipped: []RestoreSkip{}}
+	err := repo.DB.Transaction(func(tx *gorm.DB) error {
+		txRepo := &GenericRepository{DB: tx}
+		for _, id := range ids {
+			product, err := txRepo.Restore(id)
+			reason := ""
+			switch {
+			case errors.Is(err, gorm.ErrRecordNotFound):
+				reason = "not found"
+			case errors.Is(err, ErrNotDeleted):
+				reason = "not deleted"
+			case conflictMessage(err) != "":
+				reason = conflictMessage(err)
+			case err != nil:
+				return err
+			}
+			if reason != "" {
+				result.Skipped = append(result.Skipped, RestoreSkip{ID: id, Reason: reason})
+				continue
+			}
+			result.Restored = append(result.Restored, *product)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetDeleted lists soft-deleted products, most recently deleted first
+func (repo *GenericRepository) GetDeleted(opts ListOptions) ([]Product, int64, error) {
+	var total int64
+	query := repo.DB.Model(&Product{}).Where("is_deleted = ?", true)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	products := []Product{}
+	err := query.Order("deleted_at DESC, id DESC").Scopes(paginate(opts)).Find(&products).Error
+	return products, total, err
+}
+
+// Patch writes only the given columns of an already loaded product
+func (repo *GenericRepository) Patch(product *Product, columns []string) (*Product, error) {
+	if err := repo.checkConflicts(product); err != nil {
+		return nil, err
+	}
+	columns = append(columns, "search_text", "updated_at")
+	product.UpdatedAt = time.Now().UTC()
+	err := repo.DB.Model(product).Select(columns).Updates(product).Error
+	if err != nil {
+		return nil, translateProductError(err)
+	}
+	return product, nil
+}
+
+// Handlers
+func PatchProduct(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	productID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	var fields map[string]json.RawMessage
+	if err := decodeJSON(body, &fields); err != nil {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid input", []string{err.Error()})
+		return
+	}
+
+	var errs []string
+	var columns []string
+	for name := range fields {
+		switch {
+		case name == "is_deleted":
+			if len(fields) > 1 {
+				errs = append(errs, "is_deleted must be patched on its own")
+			}
+		case protectedFields[name]:
+			errs = append(errs, name+" cannot be modified")
+		case patchableFields[name]:
+			columns = append(columns, name)
+		default:
+			errs = append(errs, "unknown field "+name)
+		}
+	}
+	if len(fields) == 0 {
+		errs = append(errs, "no fields to update")
+	}
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		respondWithError(w, r, http.StatusBadRequest, "Invalid patch", errs)
+		return
+	}
+
+	if raw, ok := fields["is_deleted"]; ok {
+		var deleted bool
+		if err := decodeJSON(raw, &deleted); err != nil {
+			respondWithError(w, r, http.StatusBadRequest, "Invalid patch", []string{"is_deleted must be a boolean"})
+			return
+		}
+		patchDeletion(w, r, uint(productID), deleted)
+		return
+	}
+
+	product, err := productRepo.WithContext(r.Context()).GetById(uint(productID))
+	if err != nil {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+	var sent Product
+	if err := decodeJSON(body, &sent); err != nil {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid input", []string{err.Error()})
+		return
+	}
+	present := make(map[string]bool, len(fields))
+	for name := range fields {
+		present[name] = true
+	}
+	if errs := checkFieldPermissions(r.Context(), present, &sent, product); len(errs) > 0 {
+		respondWithError(w, r, http.StatusForbidden, "Forbidden", errs)
+		return
+	}
+	// Decoding over the stored product only replaces the fields present
+	if err := decodeJSON(body, product); err != nil {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid input", []string{err.Error()})
+		return
+	}
+	if errs := product.Validate(); len(errs) > 0 {
+		respondWithValidationErrors(w, r, errs)
+		return
+	}
+	updatedProduct, err := productRepo.WithContext(r.Context()).Patch(product, columns)
+	if message := conflictMessage(err); message != "" {
+		http.Error(w, message, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error updating product", http.StatusInternalServerError)
+		return
+	}
+	emitEvent(r.Context(), EventProductUpdated, updatedProduct)
+	response := ApiResponse{Success: true, Data: updatedProduct, Message: "Product updated successfully"}
+	respondWithJSON(w, r, response)
+}
+
+func GetDeletedProducts(w http.ResponseWriter, r *http.Request) {
+	params := NewQueryParams(r)
+	opts := ParseListOptions(params)
+	if !params.Valid() {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid query parameters", params.Errors)
+		return
+	}
+	products, total, err := productRepo.WithContext(r.Context()).GetDeleted(opts)
+	if err != nil {
+		http.Error(w, "Error fetching deleted products", http.StatusInternalServerError)
+		return
+	}
+	meta := newPageMeta(opts, total, len(products))
+	respondWithPage(w, r, products, "Deleted products retrieved successfully", meta)
+}
+
+func RestoreProducts(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		IDs []uint `json:"ids"`
+	}
+	if err := decodeBody(r, &body); err != nil {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid input", []string{err.Error()})
+		return
+	}
+	if len(body.IDs) == 0 || len(body.IDs) > maxRestoreBatchSize {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid input", []string{fmt.Sprintf("ids must contain between 1 and %d ids", maxRestoreBatchSize)})
+		return
+	}
+	result, err := productRepo.WithContext(r.Context()).RestoreBatch(body.IDs)
+	if err != nil {
+		http.Error(w, "Error restoring products", http.StatusInternalServerError)
+		return
+	}
+	for i := range result.Restored {
+		emitEvent(r.Context(), EventProductRestored, &result.Restored[i])
+	}
+	message := fmt.Sprintf("%d restored, %d skipped", len(result.Restored), len(result.Skipped))
+	response := ApiResponse{Success: true, Data: result, Message: message}
+	respondWithJSON(w, r, response)
+}
+
+// patchDeletion routes an is_deleted patch through the regular delete and
+// restore logic instead of writing the column directly
+func patchDeletion(w http.ResponseWriter, r *http.Request, id uint, deleted bool) {
+	if deleted {
+		_, err := productStore(r.Context()).Delete(id, "")
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "Product not found", http.StatusNotFound)
+			return
+		}
+		if isReadOnlyError(err) {
+			w.Header().Set("Retry-After", "30")
+			respondWithError(w, r, http.StatusServiceUnavailable, "Service temporarily read-only", nil)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Error deleting product", http.StatusInternalServerError)
+			return
+		}
+		emitEvent(r.Context(), EventProductDeleted, map[string]uint{"id": id})
+		response := ApiResponse{Success: true, Message: "Product deleted successfully"}
+		respondWithJSON(w, r, response)
+		return
+	}
+	restoredProduct, err := productRepo.WithContext(r.Context()).Restore(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, ErrNotDeleted) {
+		http.Error(w, "Product is not deleted", http.StatusConflict)
+		return
+	}
+	if message := conflictMessage(err); message != "" {
+		http.Error(w, message, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error restoring product", http.StatusInternalServerError)
+		return
+	}
+	emitEvent(r.Context(), EventProductRestored, restoredProduct)
+	response := ApiResponse{Success: true, Data: restoredProduct, Message: "Product restored successfully"}
+	respondWithJSON(w, r, response)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestPatchDecodesWithStrictDecode(t *testing.T) {
+	setupTestDB(t)
+	previous := config.StrictDecode
+	t.Cleanup(func() { config.StrictDecode = previous })
+
+	config.StrictDecode = false
+	if err := decodeJSON([]byte(`{"name":"Widget","bogus":1}`), &Product{}); err != nil {
+		t.Fatalf("lenient decode: %v", err)
+	}
+	config.StrictDecode = true
+	if err := decodeJSON([]byte(`{"name":"Widget","bogus":1}`), &Product{}); err == nil {
+		t.Fatal("strict decode accepted an unknown field")
+	}
+
+	w := serve(CreateProduct, "POST", "/products", map[string]interface{}{"name": "Widget", "sku": "W-1", "price": 5}, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("create: got %d: %s", w.Code, w.Body)
+	}
+	id := strconv.Itoa(int(decodeProduct(t, w).ID))
+	vars := map[string]string{"id": id}
+	if w = serve(PatchProduct, "PATCH", "/products/"+id, map[string]interface{}{"price": 7}, vars); w.Code != http.StatusOK {
+		t.Fatalf("strict patch: got %d: %s", w.Code, w.Body)
+	}
+	if got := decodeProduct(t, w); got.Price != 7 || got.Name != "Widget" {
+		t.Fatalf("strict patch: got %+v", got)
+	}
+	if w = serve(PatchProduct, "PATCH", "/products/"+id, map[string]interface{}{"prce": 7}, vars); w.Code != http.StatusBadRequest {
+		t.Fatalf("patch with a typo: got %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestPatchDeletionReportsStoreErrors(t *testing.T) {
+	setupTestDB(t)
+	vars := map[string]string{"id": "1"}
+	if w := serve(PatchProduct, "PATCH", "/products/1", map[string]interface{}{"is_deleted": true}, vars); w.Code != http.StatusNotFound {
+		t.Fatalf("deleting a missing product: got %d: %s", w.Code, w.Body)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.Close()
+	if w := serve(PatchProduct, "PATCH", "/products/1", map[string]interface{}{"is_deleted": true}, vars); w.Code != http.StatusInternalServerError {
+		t.Fatalf("deleting on a closed database: got %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestPatchDeletionOnReadOnlyDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "product.db")
+	database, err := gorm.Open(sqlite.Open(path), &gorm.Config{TranslateError: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrate(database); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.Create(&Product{Name: "Widget", Price: 5}).Error; err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := database.DB()
+	sqlDB.Close()
+
+	readOnly, err := gorm.Open(sqlite.Open("file:"+path+"?mode=ro"), &gorm.Config{TranslateError: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := readOnly.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	previous := productRepo
+	productRepo = &GenericRepository{DB: readOnly}
+	t.Cleanup(func() { productRepo = previous })
+
+	w := serve(PatchProduct, "PATCH", "/products/1", map[string]interface{}{"is_deleted": true}, map[string]string{"id": "1"})
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("deleting on a read-only database: got %d: %s", w.Code, w.Body)
+	}
+}
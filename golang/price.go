@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Price accepts plain JSON numbers as well as formatted strings such as
+// "$1,234.56", "R$ 1.234,56" or "1 234,56 EUR".
+type Price float64
+
+// Languages that write decimals with a comma
+var decimalCommaLanguages = map[string]bool{
+	"pt": true, "es": true, "fr": true, "de": true, "it": true,
+	"nl": true, "ru": true, "pl": true, "tr": true, "sv": true,
+}
+
+// MarshalJSON writes a number, or with PRICES_AS_STRINGS a decimal string
+// such as "19.99" for clients that parse JSON numbers as floats. It's on
+// Price rather than Product so tier prices, conversions and the rest are
+// encoded the same way as the product's own price.
+func (p Price) MarshalJSON() ([]byte, error) {
+	if config.PricesAsStrings {
+		return json.Marshal(strconv.FormatFloat(float64(p), 'f', -1, 64))
+	}
+	return json.Marshal(float64(p))
+}
+
+func (p *Price) UnmarshalJSON(data []byte) error {
+	var number float64
+	if err := json.Unmarshal(data, &number); err == nil {
+		*p = Price(number)
+		return nil
+	}
+	var raw string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("price must be a number or a string")
+	}
+	value, err := ParsePrice(raw, config.PriceLocale)
+	if err != nil {
+		return err
+	}
+	*p = Price(value)
+	return nil
+}
+
+// ParsePrice normalizes a formatted price. The locale (e.g. "pt-BR") only
+// matters when a single separator is ambiguous, like "1,234" or "1.234".
+func ParsePrice(raw, locale string) (float64, error) {
+	trimmed := strings.TrimFunc(raw, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsLetter(r) || unicode.Is(unicode.Sc, r)
+	})
+	var digits strings.Builder
+	for _, r := range trimmed {
+		switch {
+		case r >= '0' && r <= '9', r == '.', r == ',', r == '-':
+			digits.WriteRune(r)
+		case unicode.IsSpace(r), r == '\'':
+			// Thousands separators used by fr-FR and de-CH
+		default:
+			return 0, fmt.Errorf("invalid price %q", raw)
+		}
+	}
+	number := digits.String()
+	if number == "" {
+		return 0, fmt.Errorf("invalid price %q", raw)
+	}
+
+	decimal := decimalSeparator(number, locale)
+	thousands := "."
+	if decimal == '.' {
+		thousands = ","
+	}
+	number = strings.ReplaceAll(number, thousands, "")
+	number = strings.Replace(number, string(decimal), ".", 1)
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid price %q", raw)
+	}
+	return value, nil
+}
+
+func decimalSeparator(number, locale string) rune {
+	lastDot := strings.LastIndex(number, ".")
+	lastComma := strings.LastIndex(number, ",")
+	switch {
+	case lastDot >= 0 && lastComma >= 0:
+		// Both present: whichever comes last separates the decimals
+		if lastComma > lastDot {
+			return ','
+		}
+		return '.'
+	case lastComma >= 0:
+		if strings.Count(number, ",") > 1 {
+			return '.'
+		}
+		if locale != "" {
+			if usesDecimalComma(locale) {
+				return ','
+			}
+			return '.'
+		}
+		// Without a hint "1,234" is read as thousands and "12,50" as decimals
+		if len(number)-lastComma-1 == 3 {
+			return '.'
+		}
+		return ','
+	case lastDot >= 0:
+		if strings.Count(number, ".") > 1 {
+			return ','
+		}
+		if locale != "" && usesDecimalComma(locale) {
+			return ','
+		}
+		return '.'
+	}
+	return '.'
+}
+
+func usesDecimalComma(locale string) bool {
+	language := strings.ToLower(strings.SplitN(strings.ReplaceAll(locale, "_", "-"), "-", 2)[0])
+	return decimalCommaLanguages[language]
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// How often the purge job looks for expired soft-deleted products
+const purgeInterval = time.Hour
+
+// PurgeDeleted hard-deletes products soft-deleted before the given time,
+// along with everything attached to them
+func (repo *GenericRepository) PurgeDeleted(before time.Time) (int64, error) {
+	var purged int64
+	err := repo.DB.Transaction(func(tx *gorm.DB) error {
+		expired := tx.Model(&Product{}).Select("id").Where("is_deleted = ? AND deleted_at < ?", true, before)
+		cleanups := []*gorm.DB{
+			tx.Where("product_id IN (?)", expired).Delete(&ProductImage{}),
+			tx.Where("product_id IN (?)", expired).Delete(&ProductTag{}),
+			tx.Where("product_id IN (?)", expired).Delete(&Reservation{}),
+			tx.Where("product_id IN (?)", expired).Delete(&ProductTranslation{}),
+			tx.Where("product_id IN (?)", expired).Delete(&PriceTier{}),
+			tx.Where("product_id IN (?)", expired).Delete(&WarehouseStock{}),
+			tx.Where("product_id IN (?)", expired).Delete(&PriceChange{}),
+			tx.Where("product_id IN (?)", expired).Delete(&StockMovement{}),
+			tx.Where("product_id IN (?) OR related_id IN (?)", expired, expired).Delete(&RelatedProduct{}),
+		}
+		for _, cleanup := range cleanups {
+			if cleanup.Error != nil {
+				return cleanup.Error
+			}
+		}
+		result := tx.Where("is_deleted = ? AND deleted_at < ?", true, before).Delete(&Product{})
+		purged = result.RowsAffected
+		return result.Error
+	})
+	return purged, err
+}
+
+// StartPurgeJob runs the purge once right away and then every purgeInterval
+// until ctx is cancelled.
+func StartPurgeJob(ctx context.Context, wg *sync.WaitGroup, retention time.Duration) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(purgeInterval)
+		defer ticker.Stop()
+		for {
+			purged, err := productRepo.PurgeDeleted(time.Now().UTC().Add(-retention))
+			if err != nil {
+				log.Println("Error purging deleted products: ", err)
+			} else {
+				log.Printf("Purged %d deleted products", purged)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
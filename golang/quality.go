@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+)
+
+// Each check is a condition matching the products that fail it
+var productIssueChecks = []struct {
+	issue     string
+	condition string
+}{
+	{"missing description", "TRIM(COALESCE(description, '')) = ''"},
+	{"price is zero", "price = 0"},
+	{"no category", "category_id IS NULL"},
+	{"no images", "NOT EXISTS (SELECT 1 FROM product_images WHERE product_images.product_id = products.id)"},
+}
+
+type ProductIssues struct {
+	Product Product  `json:"product"`
+	Issues  []string `json:"issues"`
+}
+
+// GetProductIssues runs one query per check and merges the results by
+// product, in id order. The page in opts applies to the merged list.
+func (repo *GenericRepository) GetProductIssues(opts ListOptions) ([]ProductIssues, int64, error) {
+	issues := map[uint][]string{}
+	for _, check := range productIssueChecks {
+		var ids []uint
+		err := repo.DB.Model(&Product{}).Where("is_deleted = ?", false).
+			Where(check.condition).Pluck("id", &ids).Error
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, id := range ids {
+			issues[id] = append(issues[id], check.issue)
+		}
+	}
+
+	ids := make([]uint, 0, len(issues))
+	for id := range issues {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	total := int64(len(ids))
+	start := 0
+	if opts.PageSize > 0 {
+		start = (opts.Page - 1) * opts.PageSize
+	}
+	if start > len(ids) {
+		start = len(ids)
+	}
+	end := start + resultLimit(opts)
+	if end > len(ids) {
+		end = len(ids)
+	}
+	ids = ids[start:end]
+
+	products, err := repo.GetByIds(ids)
+	if err != nil {
+		return nil, 0, err
+	}
+	results := make([]ProductIssues, 0, len(ids))
+	for _, id := range ids {
+		if product, ok := products[id]; ok {
+			results = append(results, ProductIssues{Product: product, Issues: issues[id]})
+		}
+	}
+	return results, total, nil
+}
+
+// Handlers
+func GetProductIssues(w http.ResponseWriter, r *http.Request) {
+	params := NewQueryParams(r)
+	opts := ParseListOptions(params)
+	if !params.Valid() {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid query parameters", params.Errors)
+		return
+	}
+	results, total, err := productRepo.WithContext(r.Context()).GetProductIssues(opts)
+	if err != nil {
+		http.Error(w, "Error checking products", http.StatusInternalServerError)
+		return
+	}
+	meta := newPageMeta(opts, total, len(results))
+	respondWithPage(w, r, results, "Products with issues retrieved successfully", meta)
+}
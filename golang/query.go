@@ -0,0 +1,390 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// QueryParams parses and validates URL query values. Problems are collected
+// instead of returned so the client gets all of them in a single 400.
+type QueryParams struct {
+	values url.Values
+	Errors []string
+}
+
+func NewQueryParams(r *http.Request) *QueryParams {
+	return &QueryParams{values: r.URL.Query()}
+}
+
+func (q *QueryParams) Valid() bool {
+	return len(q.Errors) == 0
+}
+
+func (q *QueryParams) addError(format string, args ...interface{}) {
+	q.Errors = append(q.Errors, fmt.Sprintf(format, args...))
+}
+
+// Int returns the named integer or fallback when absent. Values outside
+// [min, max] are rejected.
+func (q *QueryParams) Int(name string, fallback, min, max int) int {
+	raw := q.values.Get(name)
+	if raw == "" {
+		return fallback
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil {
+		q.addError("%s must be an integer", name)
+		return fallback
+	}
+	if value < min || value > max {
+		q.addError("%s must be between %d and %d", name, min, max)
+		return fallback
+	}
+	return value
+}
+
+// OptionalFloat returns nil when the named value is absent
+func (q *QueryParams) OptionalFloat(name string, min, max float64) *float64 {
+	raw := q.values.Get(name)
+	if raw == "" {
+		return nil
+	}
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil || math.IsNaN(value) {
+		q.addError("%s must be a number", name)
+		return nil
+	}
+	if value < min || value > max {
+		q.addError("%s must be between %g and %g", name, min, max)
+		return nil
+	}
+	return &value
+}
+
+func (q *QueryParams) Bool(name string, fallback bool) bool {
+	raw := q.values.Get(name)
+	if raw == "" {
+		return fallback
+	}
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		q.addError("%s must be true or false", name)
+		return fallback
+	}
+	return value
+}
+
+// IDList parses a comma-separated list of ids such as "1,2,3". Duplicates
+// are dropped and the count must be within [min, max].
+func (q *QueryParams) IDList(name string, min, max int) []uint {
+	var ids []uint
+	seen := map[uint]bool{}
+	for _, raw := range strings.Split(q.values.Get(name), ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil || id == 0 {
+			q.addError("%s must be a list of positive integers", name)
+			return nil
+		}
+		if !seen[uint(id)] {
+			seen[uint(id)] = true
+			ids = append(ids, uint(id))
+		}
+	}
+	if len(ids) < min || len(ids) > max {
+		q.addError("%s must contain between %d and %d ids", name, min, max)
+		return nil
+	}
+	return ids
+}
+
+// Values parses a comma-separated list of names, such as include=sale,
+// into a set. Names outside allowed are rejected.
+func (q *QueryParams) Values(name string, allowed map[string]bool) map[string]bool {
+	values := map[string]bool{}
+	for _, raw := range strings.Split(q.values.Get(name), ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		if !allowed[raw] {
+			q.addError("%s: unknown value %q", name, raw)
+			continue
+		}
+		values[raw] = true
+	}
+	return values
+}
+
+// Sort parses a sort expression like "-price,name" into an ORDER BY clause,
+// falling back to the given expression when the parameter is absent
+func (q *QueryParams) Sort(name string, allowed map[string]bool, fallback string) string {
+	raw := q.values.Get(name)
+	if raw == "" {
+		raw = fallback
+	}
+	order, err := parseSort(raw, allowed)
+	if err != nil {
+		q.addError("%s: %v", name, err)
+		return "id ASC"
+	}
+	return order
+}
+
+// parseSort validates a comma-separated list of fields, each optionally
+// prefixed with "-" for descending order. id is appended as a tie-breaker so
+// pages never overlap.
+func parseSort(value string, allowed map[string]bool) (string, error) {
+	var clauses []string
+	hasID := false
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		direction := "ASC"
+		if strings.HasPrefix(field, "-") {
+			direction = "DESC"
+			field = field[1:]
+		}
+		if !allowed[field] {
+			return "", fmt.Errorf("cannot sort by %q", field)
+		}
+		hasID = hasID || field == "id"
+		if expression, ok := sortExpressions[field]; ok {
+			field = expression
+		}
+		clauses = append(clauses, field+" "+direction)
+	}
+	if !hasID {
+		clauses = append(clauses, "id ASC")
+	}
+	return strings.Join(clauses, ", "), nil
+}
+
+// Columns products can be sorted by, in the sort parameter and DEFAULT_SORT
+var productSortFields = map[string]bool{
+	"id":             true,
+	"name":           true,
+	"price":          true,
+	"stock_quantity": true,
+	"created_at":     true,
+	"updated_at":     true,
+	"view_count":     true,
+	"margin":         true,
+}
+
+// Sort fields computed in SQL rather than stored in a column
+var sortExpressions = map[string]string{
+	"margin": marginSortExpression,
+}
+
+const maxPageSize = 500
+
+// ListOptions holds the pagination and filters shared by list endpoints
+type ListOptions struct {
+	Page int
+	// PageSize of zero means the list is not paginated
+	PageSize int
+	MinPrice *float64
+	MaxPrice *float64
+	// Query matches names case-insensitively
+	Query string
+	// CategoryIDs restricts the list to products in any of these categories
+	CategoryIDs []uint
+	// Order is a validated ORDER BY clause; empty keeps the list's own order
+	Order string
+}
+
+// ParseListOptions parses paging for lists that can't be searched or
+// filtered, rejecting q, min_price and max_price rather than ignoring them
+func ParseListOptions(q *QueryParams) ListOptions {
+	for _, name := range []string{"q", "min_price", "max_price"} {
+		if q.values.Has(name) {
+			q.addError("%s: not supported by this list", name)
+		}
+	}
+	return parseListOptions(q)
+}
+
+func parseListOptions(q *QueryParams) ListOptions {
+	return ListOptions{
+		Page:     q.Int("page", 1, 1, math.MaxInt32),
+		PageSize: q.Int("page_size", 0, 1, maxPageSize),
+	}
+}
+
+// parseSearchListOptions adds the name search, ?q=, to paging for lists
+// that apply nameSearch. Only product lists filter by price.
+func parseSearchListOptions(q *QueryParams) ListOptions {
+	for _, name := range []string{"min_price", "max_price"} {
+		if q.values.Has(name) {
+			q.addError("%s: not supported by this list", name)
+		}
+	}
+	opts := parseListOptions(q)
+	opts.Query = strings.TrimSpace(q.values.Get("q"))
+	return opts
+}
+
+// Most categories a product list can be filtered by at once
+const maxCategoryFilter = 100
+
+// parseProductListOptions adds the name search, the price range, product
+// sorting and the category filter, such as category_id=1,2,3, to paging
+func parseProductListOptions(q *QueryParams) ListOptions {
+	opts := parseListOptions(q)
+	opts.Query = strings.TrimSpace(q.values.Get("q"))
+	opts.MinPrice = q.OptionalFloat("min_price", 0, math.MaxFloat64)
+	opts.MaxPrice = q.OptionalFloat("max_price", 0, math.MaxFloat64)
+	if opts.MinPrice != nil && opts.MaxPrice != nil && *opts.MinPrice > *opts.MaxPrice {
+		q.addError("min_price must not be greater than max_price")
+	}
+	opts.Order = q.Sort("sort", productSortFields, config.DefaultSort)
+	opts.CategoryIDs = q.IDList("category_id", 0, maxCategoryFilter)
+	return opts
+}
+
+type PageMeta struct {
+	Page      int   `json:"page"`
+	PageSize  int   `json:"page_size"`
+	Total     int64 `json:"total"`
+	Truncated bool  `json:"truncated,omitempty"`
+}
+
+// newPageMeta flags lists that came back shorter than the page asked for
+// because of MAX_RESULTS
+func newPageMeta(opts ListOptions, total int64, returned int) PageMeta {
+	expected := total
+	if opts.PageSize > 0 {
+		expected = total - int64((opts.Page-1)*opts.PageSize)
+		if expected > int64(opts.PageSize) {
+			expected = int64(opts.PageSize)
+		}
+	}
+	return PageMeta{
+		Page:      opts.Page,
+		PageSize:  opts.PageSize,
+		Total:     total,
+		Truncated: int64(returned) < expected,
+	}
+}
+
+// respondWithPage renders a list with its pagination as PAGINATION_STYLE
+// asks: meta in the body, Link and X-Total-Count headers, or both
+func respondWithPage(w http.ResponseWriter, r *http.Request, data interface{}, message string, meta PageMeta) {
+	style := config.PaginationStyle
+	if style == "headers" || style == "both" {
+		writePageHeaders(w, r, meta)
+	}
+	response := ApiResponse{Success: true, Data: data, Message: message}
+	if style != "headers" {
+		response.Meta = meta
+	}
+	respondWithJSON(w, r, response)
+}
+
+// writePageHeaders sets RFC 8288 links to the neighbouring pages, keeping
+// the rest of the query string
+func writePageHeaders(w http.ResponseWriter, r *http.Request, meta PageMeta) {
+	w.Header().Set("X-Total-Count", strconv.FormatInt(meta.Total, 10))
+	if meta.Truncated {
+		w.Header().Set("X-Results-Truncated", "true")
+	}
+	if meta.PageSize == 0 {
+		return
+	}
+	last := int((meta.Total + int64(meta.PageSize) - 1) / int64(meta.PageSize))
+	if last < 1 {
+		last = 1
+	}
+	link := func(page int, rel string) string {
+		target := *r.URL
+		query := target.Query()
+		query.Set("page", strconv.Itoa(page))
+		target.RawQuery = query.Encode()
+		return fmt.Sprintf("<%s>; rel=%q", target.RequestURI(), rel)
+	}
+	links := []string{link(1, "first")}
+	if meta.Page > 1 {
+		links = append(links, link(meta.Page-1, "prev"))
+	}
+	if meta.Page < last {
+		links = append(links, link(meta.Page+1, "next"))
+	}
+	links = append(links, link(last, "last"))
+	w.Header().Set("Link", strings.Join(links, ", "))
+}
+
+// resultLimit is the page size, capped at MAX_RESULTS. Unpaginated lists
+// get the cap so a large table can't blow up a response.
+func resultLimit(opts ListOptions) int {
+	if opts.PageSize == 0 || opts.PageSize > config.MaxResults {
+		return config.MaxResults
+	}
+	return opts.PageSize
+}
+
+// Scopes
+func paginate(opts ListOptions) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if opts.PageSize == 0 {
+			return db.Limit(resultLimit(opts))
+		}
+		return db.Offset((opts.Page - 1) * opts.PageSize).Limit(resultLimit(opts))
+	}
+}
+
+func ordered(opts ListOptions) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if opts.Order == "" {
+			return db
+		}
+		return db.Order(opts.Order)
+	}
+}
+
+func nameSearch(opts ListOptions) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if opts.Query == "" {
+			return db
+		}
+		return db.Where("LOWER(name) LIKE ? ESCAPE '\\'", likePattern(opts.Query))
+	}
+}
+
+// likePattern builds a substring LIKE pattern, escaping wildcards in the input
+func likePattern(value string) string {
+	escaped := strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_").Replace(strings.ToLower(value))
+	return "%" + escaped + "%"
+}
+
+func inCategories(opts ListOptions) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if len(opts.CategoryIDs) == 0 {
+			return db
+		}
+		return db.Where("category_id IN ?", opts.CategoryIDs)
+	}
+}
+
+func priceRange(opts ListOptions) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if opts.MinPrice != nil {
+			db = db.Where("price >= ?", *opts.MinPrice)
+		}
+		if opts.MaxPrice != nil {
+			db = db.Where("price <= ?", *opts.MaxPrice)
+		}
+		return db
+	}
+}
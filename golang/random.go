@@ -0,0 +1,91 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"net/http"
+	"sort"
+)
+
+const (
+	defaultRandomLimit = 1
+	maxRandomLimit     = 20
+	// Weighted picks are drawn from this many random candidates, so the
+	// sampling never loads the whole catalog
+	randomCandidatePool = 1000
+)
+
+// Columns random picks can be weighted by
+var randomWeightFields = map[string]bool{
+	"view_count":     true,
+	"stock_quantity": true,
+}
+
+// GetRandom picks limit distinct active products, uniformly or, with
+// weightBy set, with probability proportional to that column
+func (repo *GenericRepository) GetRandom(limit int, weightBy string) ([]Product, error) {
+	products := []Product{}
+	active := repo.DB.Where("is_deleted = ?", false)
+	if weightBy == "" {
+		err := active.Order(orderByExpr("RANDOM()")).Limit(limit).Find(&products).Error
+		return products, err
+	}
+
+	var candidates []struct {
+		ID     uint
+		Weight float64
+	}
+	err := repo.DB.Model(&Product{}).Select("id, "+weightBy+" AS weight").
+		Where("is_deleted = ?", false).
+		Order(orderByExpr("RANDOM()")).Limit(randomCandidatePool).
+		Scan(&candidates).Error
+	if err != nil {
+		return nil, err
+	}
+	// Efraimidis-Spirakis: the largest u^(1/w) keys form a weighted sample
+	// without replacement. Zero weights key to 0 and only fill leftover spots.
+	keys := make(map[uint]float64, len(candidates))
+	ids := make([]uint, len(candidates))
+	for i, candidate := range candidates {
+		ids[i] = candidate.ID
+		if candidate.Weight > 0 {
+			keys[candidate.ID] = math.Pow(rand.Float64(), 1/candidate.Weight)
+		}
+	}
+	sort.SliceStable(ids, func(i, j int) bool { return keys[ids[i]] > keys[ids[j]] })
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+
+	found, err := repo.GetByIds(ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		if product, ok := found[id]; ok {
+			products = append(products, product)
+		}
+	}
+	return products, nil
+}
+
+// Handlers
+func GetRandomProducts(w http.ResponseWriter, r *http.Request) {
+	params := NewQueryParams(r)
+	limit := params.Int("limit", defaultRandomLimit, 1, maxRandomLimit)
+	weightBy := r.URL.Query().Get("weight_by")
+	if weightBy != "" && !randomWeightFields[weightBy] {
+		params.addError("cannot weight by %q", weightBy)
+	}
+	if !params.Valid() {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid query parameters", params.Errors)
+		return
+	}
+	products, err := productRepo.WithContext(r.Context()).GetRandom(limit, weightBy)
+	if err != nil {
+		http.Error(w, "Error fetching products", http.StatusInternalServerError)
+		return
+	}
+	response := ApiResponse{Success: true, Data: products, Message: "Products retrieved successfully"}
+	respondWithJSON(w, r, response)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Idle buckets are dropped after this long; a full bucket is the same as
+// a missing one
+const rateLimitIdle = 10 * time.Minute
+
+// routeRateLimitDefaults are the per-minute limits of expensive routes when
+// RATE_LIMITS doesn't set them; other routes get RATE_LIMIT. Keys are route
+// templates. Health checks are never limited.
+var routeRateLimitDefaults = map[string]int{
+	"/livez":                  0,
+	"/readyz":                 0,
+	"/products/export":        10,
+	"/products/stream-import": 10,
+	"/products/search":        60,
+	"/sitemap.xml":            10,
+}
+
+// routeRateLimit is the per-minute limit of a route, 0 for unlimited
+func routeRateLimit(template string) int {
+	if limit, ok := config.RateLimits[template]; ok {
+		return limit
+	}
+	if limit, ok := routeRateLimitDefaults[template]; ok {
+		return limit
+	}
+	return config.RateLimit
+}
+
+// checkRateLimits reports RATE_LIMITS entries that aren't route templates
+// or have a negative limit
+func checkRateLimits(limits map[string]int) error {
+	var invalid []string
+	for route, limit := range limits {
+		if !strings.HasPrefix(route, "/") || limit < 0 {
+			invalid = append(invalid, route)
+		}
+	}
+	if len(invalid) > 0 {
+		sort.Strings(invalid)
+		return fmt.Errorf("invalid limits for %v", invalid)
+	}
+	return nil
+}
+
+type rateBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// RateLimiter keeps a token bucket per route and client IP. Buckets hold a
+// minute's worth of requests and refill continuously, so short bursts are
+// allowed as long as the average stays under the limit.
+type RateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*rateBucket
+	pruned  time.Time
+}
+
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{buckets: map[string]*rateBucket{}, pruned: time.Now()}
+}
+
+// take spends a token from the bucket for key, reporting whether there was
+// one, the tokens left and how long until the next one
+func (l *RateLimiter) take(key string, limit int) (bool, int, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.prune(now)
+	rate := float64(limit) / time.Minute.Seconds()
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &rateBucket{tokens: float64(limit), updated: now}
+		l.buckets[key] = bucket
+	}
+	bucket.tokens = math.Min(float64(limit), bucket.tokens+now.Sub(bucket.updated).Seconds()*rate)
+	bucket.updated = now
+	if bucket.tokens < 1 {
+		wait := time.Duration((1 - bucket.tokens) / rate * float64(time.Second))
+		return false, 0, wait
+	}
+	bucket.tokens--
+	return true, int(bucket.tokens), 0
+}
+
+// prune drops idle buckets once per rateLimitIdle; the lock must be held
+func (l *RateLimiter) prune(now time.Time) {
+	if now.Sub(l.pruned) < rateLimitIdle {
+		return
+	}
+	for key, bucket := range l.buckets {
+		if now.Sub(bucket.updated) > rateLimitIdle {
+			delete(l.buckets, key)
+		}
+	}
+	l.pruned = now
+}
+
+var rateLimiter = NewRateLimiter()
+
+func clientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// routeTemplate is the template of the route a request matched, such as
+// /products/{id}, or its path when it matched none
+func routeTemplate(r *http.Request) string {
+	if current := mux.CurrentRoute(r); current != nil {
+		if template, err := current.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return r.URL.Path
+}
+
+// RateLimitMiddleware limits each client IP per route, answering 429 once a
+// route's bucket is empty. Responses carry the route's limit and what's
+// left of it in X-RateLimit-* headers.
+func RateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		template := routeTemplate(r)
+		limit := routeRateLimit(template)
+		if limit <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		allowed, remaining, wait := rateLimiter.take(template+" "+clientIP(r), limit)
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limit))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		if !allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			respondWithError(w, r, http.StatusTooManyRequests, "Too many requests", nil)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
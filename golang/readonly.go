@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"gorm.io/gorm"
+)
+
+const readOnlyContextKey contextKey = "read_only"
+
+// Messages databases give when refusing a write: a Postgres hot standby
+// (SQLSTATE 25006), MySQL with --read-only and a read-only SQLite file
+var readOnlyErrorMessages = []string{
+	"read-only transaction",
+	"sqlstate 25006",
+	"--read-only option",
+	"readonly database",
+}
+
+func isReadOnlyError(err error) bool {
+	if err == nil {
+		return false
+	}
+	message := strings.ToLower(err.Error())
+	for _, fragment := range readOnlyErrorMessages {
+		if strings.Contains(message, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+// registerReadOnlyCallbacks flags the request when a write statement is
+// refused because the database is read-only
+func registerReadOnlyCallbacks(db *gorm.DB) error {
+	callbacks := db.Callback()
+	registers := []func(string, func(*gorm.DB)) error{
+		callbacks.Create().After("gorm:create").Register,
+		callbacks.Update().After("gorm:update").Register,
+		callbacks.Delete().After("gorm:delete").Register,
+		callbacks.Raw().After("gorm:raw").Register,
+	}
+	for _, register := range registers {
+		if err := register("readonly:detect", detectReadOnly); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func detectReadOnly(tx *gorm.DB) {
+	if flag, ok := tx.Statement.Context.Value(readOnlyContextKey).(*atomic.Bool); ok && isReadOnlyError(tx.Error) {
+		flag.Store(true)
+	}
+}
+
+// bufferedResponse holds a response back until the handler has finished
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+func (b *bufferedResponse) Write(data []byte) (int, error) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	return b.body.Write(data)
+}
+
+// ReadOnlyMiddleware turns whatever error a write handler produced into a
+// 503 when the database refused a write for being read-only, e.g. during a
+// failover. Reads pass straight through, as do streaming routes, which
+// report refused writes in their own stream.
+func ReadOnlyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+		if isStreamingRoute(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		flag := &atomic.Bool{}
+		buffered := &bufferedResponse{header: http.Header{}}
+		next.ServeHTTP(buffered, r.WithContext(context.WithValue(r.Context(), readOnlyContextKey, flag)))
+		if flag.Load() {
+			log.Printf("Database is read-only, rejected %s %s", r.Method, r.URL.Path)
+			w.Header().Set("Retry-After", "30")
+			respondWithError(w, r, http.StatusServiceUnavailable, "Service temporarily read-only", nil)
+			return
+		}
+		for key, values := range buffered.header {
+			w.Header()[key] = values
+		}
+		if buffered.status == 0 {
+			buffered.status = http.StatusOK
+		}
+		w.WriteHeader(buffered.status)
+		w.Write(buffered.body.Bytes())
+	})
+}
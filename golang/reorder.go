@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+)
+
+// ReorderSuggestion is a product at or below its reorder point with the
+// quantity that brings it back up to its reorder target
+type ReorderSuggestion struct {
+	Product
+	SuggestedQuantity int `json:"suggested_quantity"`
+}
+
+// GetReorderSuggestions lists the active products whose stock has fallen to
+// their reorder point, the largest shortfall first. Products without a
+// reorder point are never suggested.
+func (repo *GenericRepository) GetReorderSuggestions(opts ListOptions) ([]ReorderSuggestion, int64, error) {
+	var total int64
+	query := repo.DB.Model(&Product{}).
+		Where("is_deleted = ? AND reorder_point IS NOT NULL AND stock_quantity <= reorder_point", false)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var products []Product
+	err := query.Order("reorder_target - stock_quantity DESC, id").Scopes(paginate(opts)).Find(&products).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	suggestions := make([]ReorderSuggestion, len(products))
+	for i, product := range products {
+		suggestions[i] = ReorderSuggestion{Product: product, SuggestedQuantity: *product.ReorderTarget - product.StockQuantity}
+	}
+	return suggestions, total, nil
+}
+
+// Handlers
+func GetReorderSuggestions(w http.ResponseWriter, r *http.Request) {
+	params := NewQueryParams(r)
+	opts := ParseListOptions(params)
+	if !params.Valid() {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid query parameters", params.Errors)
+		return
+	}
+	suggestions, total, err := productRepo.WithContext(r.Context()).GetReorderSuggestions(opts)
+	if err != nil {
+		http.Error(w, "Error fetching reorder suggestions", http.StatusInternalServerError)
+		return
+	}
+	meta := newPageMeta(opts, total, len(suggestions))
+	respondWithPage(w, r, suggestions, "Reorder suggestions retrieved successfully", meta)
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultExtremesLimit = 5
+	maxExtremesLimit     = 50
+
+	defaultRecentMinutes = 60
+	maxRecentMinutes     = 7 * 24 * 60
+)
+
+type PriceExtremes struct {
+	MostExpensive []Product `json:"most_expensive"`
+	Cheapest      []Product `json:"cheapest"`
+}
+
+// GetPriceExtremes runs one ordered LIMIT query per end of the price range
+func (repo *GenericRepository) GetPriceExtremes(limit int) (*PriceExtremes, error) {
+	extremes := &PriceExtremes{}
+	err := repo.DB.Where("is_deleted = ?", false).Order("price DESC, id").Limit(limit).Find(&extremes.MostExpensive).Error
+	if err != nil {
+		return nil, err
+	}
+	err = repo.DB.Where("is_deleted = ?", false).Order("price ASC, id").Limit(limit).Find(&extremes.Cheapest).Error
+	if err != nil {
+		return nil, err
+	}
+	return extremes, nil
+}
+
+// Columns that can be faceted. The name is interpolated into the query, so
+// only these are ever accepted.
+var productFacetFields = map[string]bool{
+	"category_id":    true,
+	"price":          true,
+	"stock_quantity": true,
+}
+
+type Facet struct {
+	Value interface{} `json:"value"`
+	Count int64       `json:"count"`
+}
+
+// GetFacets returns the distinct values of a column among active products,
+// most common first
+func (repo *GenericRepository) GetFacets(field string) ([]Facet, error) {
+	rows, err := repo.DB.Model(&Product{}).
+		Select(field+" AS value, COUNT(*) AS count").
+		Where("is_deleted = ?", false).
+		Group(field).
+		Order("count DESC, value").
+		Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	facets := []Facet{}
+	for rows.Next() {
+		var facet Facet
+		if err := rows.Scan(&facet.Value, &facet.Count); err != nil {
+			return nil, err
+		}
+		facets = append(facets, facet)
+	}
+	return facets, rows.Err()
+}
+
+const (
+	defaultStatsDays = 30
+	maxStatsDays     = 366
+)
+
+type DailyCount struct {
+	Date  string `json:"date"`
+	Count int64  `json:"count"`
+}
+
+// GetDailyCreated counts products created per UTC day over the last days
+// days, today included. Deleted products still count: they were created.
+// Days without products are filled with zero so the series is continuous.
+func (repo *GenericRepository) GetDailyCreated(days int) ([]DailyCount, error) {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	start := today.AddDate(0, 0, -(days - 1))
+	rows, err := repo.DB.Model(&Product{}).
+		Select("CAST(DATE(created_at) AS TEXT) AS day, COUNT(*)").
+		Where("created_at >= ?", start).
+		Group("day").
+		Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[string]int64{}
+	for rows.Next() {
+		var day string
+		var count int64
+		if err := rows.Scan(&day, &count); err != nil {
+			return nil, err
+		}
+		counts[day] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	series := make([]DailyCount, 0, days)
+	for day := start; !day.After(today); day = day.AddDate(0, 0, 1) {
+		date := day.Format(time.DateOnly)
+		series = append(series, DailyCount{Date: date, Count: counts[date]})
+	}
+	return series, nil
+}
+
+// GetRecentChanges lists the active products created or updated in the last
+// minutes, most recently updated first. A created product has its updated_at
+// set too, so one filter covers both.
+func (repo *GenericRepository) GetRecentChanges(minutes int, opts ListOptions) ([]Product, int64, error) {
+	since := time.Now().UTC().Add(-time.Duration(minutes) * time.Minute)
+	var total int64
+	query := repo.DB.Model(&Product{}).Where("is_deleted = ? AND updated_at >= ?", false, since)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	products := []Product{}
+	err := query.Order("updated_at DESC, id DESC").Scopes(paginate(opts)).Find(&products).Error
+	return products, total, err
+}
+
+// Handlers
+func GetDailyStats(w http.ResponseWriter, r *http.Request) {
+	params := NewQueryParams(r)
+	days := params.Int("days", defaultStatsDays, 1, maxStatsDays)
+	if !params.Valid() {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid query parameters", params.Errors)
+		return
+	}
+	series, err := productRepo.WithContext(r.Context()).GetDailyCreated(days)
+	if err != nil {
+		http.Error(w, "Error fetching stats", http.StatusInternalServerError)
+		return
+	}
+	response := ApiResponse{Success: true, Data: series, Message: "Stats retrieved successfully"}
+	respondWithJSON(w, r, response)
+}
+
+// GetRecentChanges lets QA check which products a deploy's migration or
+// import touched
+func GetRecentChanges(w http.ResponseWriter, r *http.Request) {
+	params := NewQueryParams(r)
+	minutes := params.Int("minutes", defaultRecentMinutes, 1, maxRecentMinutes)
+	opts := ParseListOptions(params)
+	if !params.Valid() {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid query parameters", params.Errors)
+		return
+	}
+	products, total, err := productRepo.WithContext(r.Context()).GetRecentChanges(minutes, opts)
+	if err != nil {
+		http.Error(w, "Error fetching products", http.StatusInternalServerError)
+		return
+	}
+	meta := newPageMeta(opts, total, len(products))
+	respondWithPage(w, r, products, "Recent changes retrieved successfully", meta)
+}
+
+func GetProductFacets(w http.ResponseWriter, r *http.Request) {
+	field := mux.Vars(r)["field"]
+	if !productFacetFields[field] {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid facet field", []string{"cannot facet by " + field})
+		return
+	}
+	facets, err := productRepo.WithContext(r.Context()).GetFacets(field)
+	if err != nil {
+		http.Error(w, "Error fetching facets", http.StatusInternalServerError)
+		return
+	}
+	response := ApiResponse{Success: true, Data: facets, Message: "Facets retrieved successfully"}
+	respondWithJSON(w, r, response)
+}
+
+func GetProductExtremes(w http.ResponseWriter, r *http.Request) {
+	params := NewQueryParams(r)
+	limit := params.Int("limit", defaultExtremesLimit, 1, maxExtremesLimit)
+	if !params.Valid() {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid query parameters", params.Errors)
+		return
+	}
+	extremes, err := productRepo.WithContext(r.Context()).GetPriceExtremes(limit)
+	if err != nil {
+		http.Error(w, "Error fetching products", http.StatusInternalServerError)
+		return
+	}
+	response := ApiResponse{Success: true, Data: extremes, Message: "Products retrieved successfully"}
+	respondWithJSON(w, r, response)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// How often expired reservations are cleaned up
+const reservationCleanupInterval = time.Minute
+
+const maxReservationTTL = 24 * time.Hour
+
+// Reservation holds stock for a checkout until it expires. Expired
+// reservations stop counting right away; the cleanup job only deletes them.
+type Reservation struct {
+	ID        uint      `json:"id"`
+	ProductID uint      `json:"product_id" gorm:"index"`
+	Quantity  int       `json:"quantity"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"index"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// GetReserved sums the active reservations of a product
+func (repo *GenericRepository) GetReserved(id uint) (int, error) {
+	var reserved int
+	err := repo.DB.Model(&Reservation{}).
+		Select("COALESCE(SUM(quantity), 0)").
+		Where("product_id = ? AND expires_at > ?", id, time.Now().UTC()).
+		Scan(&reserved).Error
+	return reserved, err
+}
+
+// Reserve holds quantity units if that many are available, stock minus
+// active reservations, returning ErrInsufficientStock otherwise
+func (repo *GenericRepository) Reserve(id uint, quantity int, ttl time.Duration) (*Reservation, error) {
+	var reservation *Reservation
+	err := repo.DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the product row so concurrent reservations queue up; SQLite
+		// already serializes writers and has no FOR UPDATE
+		query := tx
+		if tx.Dialector.Name() != "sqlite" {
+			query = tx.Clauses(clause.Locking{Strength: "UPDATE"})
+		}
+		var product Product
+		err := query.Select("id", "stock_quantity").Where("id = ? AND is_deleted = ?", id, false).First(&product).Error
+		if err != nil {
+			return err
+		}
+		txRepo := &GenericRepository{DB: tx}
+		reserved, err := txRepo.GetReserved(id)
+		if err != nil {
+			return err
+		}
+		if product.StockQuantity-reserved < quantity {
+			return ErrInsufficientStock
+		}
+		reservation = &Reservation{ProductID: id, Quantity: quantity, ExpiresAt: time.Now().UTC().Add(ttl)}
+		return tx.Create(reservation).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reservation, nil
+}
+
+// ReleaseExpired deletes reservations that have expired
+func (repo *GenericRepository) ReleaseExpired() (int64, error) {
+	result := repo.DB.Where("expires_at <= ?", time.Now().UTC()).Delete(&Reservation{})
+	return result.RowsAffected, result.Error
+}
+
+// StartReservationJob cleans up expired reservations until ctx is cancelled
+func StartReservationJob(ctx context.Context, wg *sync.WaitGroup) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(reservationCleanupInterval)
+		defer ticker.Stop()
+		for {
+			if _, err := productRepo.ReleaseExpired(); err != nil {
+				log.Println("Error releasing expired reservations: ", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+type reserveRequest struct {
+	Quantity int `json:"quantity"`
+	// TTLSeconds defaults to RESERVATION_TTL
+	TTLSeconds int `json:"ttl_seconds"`
+}
+
+// Handlers
+func ReserveStock(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	productID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+	var request reserveRequest
+	if err := decodeBody(r, &request); err != nil {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid input", []string{err.Error()})
+		return
+	}
+	ttl := config.ReservationTTL
+	if request.TTLSeconds != 0 {
+		ttl = time.Duration(request.TTLSeconds) * time.Second
+	}
+	var errs []string
+	if request.Quantity < 1 || request.Quantity > math.MaxInt32 {
+		errs = append(errs, "quantity must be positive")
+	}
+	if ttl <= 0 || ttl > maxReservationTTL {
+		errs = append(errs, "ttl_seconds must be between 1 and "+strconv.Itoa(int(maxReservationTTL/time.Second)))
+	}
+	if len(errs) > 0 {
+		respondWithError(w, r, http.StatusUnprocessableEntity, "Invalid reservation", errs)
+		return
+	}
+	reservation, err := productRepo.WithContext(r.Context()).Reserve(uint(productID), request.Quantity, ttl)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, ErrInsufficientStock) {
+		http.Error(w, "Not enough stock available", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error reserving stock", http.StatusInternalServerError)
+		return
+	}
+	auditChanges(r.Context(), []uint{uint(productID)}, AuditStockReserved, reservation)
+	response := ApiResponse{Success: true, Data: reservation, Message: "Stock reserved successfully"}
+	respondWithJSONStatus(w, r, http.StatusCreated, response)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PriceChange records a product's price from ChangedAt until the next change
+type PriceChange struct {
+	ID        uint      `json:"id"`
+	ProductID uint      `json:"product_id" gorm:"index"`
+	Price     Price     `json:"price"`
+	ChangedAt time.Time `json:"changed_at" gorm:"index"`
+}
+
+// recordPriceChange is the price history half of Product.AfterSave: the
+// price is recorded whenever it differs from the last recorded one
+func (product *Product) recordPriceChange(tx *gorm.DB) error {
+	var last PriceChange
+	err := tx.Where("product_id = ?", product.ID).Order("id DESC").Limit(1).Find(&last).Error
+	if err != nil || (last.ID != 0 && last.Price == product.Price) {
+		return err
+	}
+	return tx.Create(&PriceChange{ProductID: product.ID, Price: product.Price, ChangedAt: time.Now().UTC()}).Error
+}
+
+// Extra data product responses can include with ?include=
+var productIncludes = map[string]bool{"sale": true, "margin": true}
+
+// SaleStatus is returned with products for ?include=sale
+type SaleStatus struct {
+	OnSale bool `json:"on_sale"`
+	// OriginalPrice is the highest price within the sale window, set while on sale
+	OriginalPrice *Price `json:"original_price"`
+}
+
+type SaleProduct struct {
+	*Product
+	SaleStatus
+}
+
+// GetSaleStatus marks products on sale when their current price was set
+// within the window and is lower than a price they had in it, counting the
+// price already in effect when the window opened
+func (repo *GenericRepository) GetSaleStatus(products []*Product, window time.Duration) ([]SaleProduct, error) {
+	sale := make([]SaleProduct, len(products))
+	if len(products) == 0 {
+		return sale, nil
+	}
+	ids := make([]uint, len(products))
+	for i, product := range products {
+		ids[i] = product.ID
+	}
+	cutoff := time.Now().UTC().Add(-window)
+	inEffect := repo.DB.Model(&PriceChange{}).Select("MAX(id)").
+		Where("product_id IN ? AND changed_at < ?", ids, cutoff).Group("product_id")
+	var changes []PriceChange
+	err := repo.DB.Where("product_id IN ? AND changed_at >= ?", ids, cutoff).Or("id IN (?)", inEffect).
+		Order("id").Find(&changes).Error
+	if err != nil {
+		return nil, err
+	}
+	byProduct := map[uint][]PriceChange{}
+	for _, change := range changes {
+		byProduct[change.ProductID] = append(byProduct[change.ProductID], change)
+	}
+	for i, product := range products {
+		sale[i].Product = product
+		history := byProduct[product.ID]
+		if len(history) < 2 || history[len(history)-1].ChangedAt.Before(cutoff) {
+			continue
+		}
+		original := history[0].Price
+		for _, change := range history[1 : len(history)-1] {
+			if change.Price > original {
+				original = change.Price
+			}
+		}
+		if original > product.Price {
+			sale[i].OnSale = true
+			sale[i].OriginalPrice = &original
+		}
+	}
+	return sale, nil
+}
+
+// saleWindow is how far back a higher price still counts for a sale
+func saleWindow() time.Duration {
+	return time.Duration(config.SaleWindowDays) * 24 * time.Hour
+}
+
+// listWithSaleStatus adds the sale status to a product list
+func listWithSaleStatus(r *http.Request, products []Product) ([]SaleProduct, error) {
+	return productRepo.WithContext(r.Context()).GetSaleStatus(productPointers(products), saleWindow())
+}
+
+func saleStatus(r *http.Request, product *Product) (*SaleStatus, error) {
+	sale, err := productRepo.WithContext(r.Context()).GetSaleStatus([]*Product{product}, saleWindow())
+	if err != nil {
+		return nil, err
+	}
+	return &sale[0].SaleStatus, nil
+}
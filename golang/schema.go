@@ -0,0 +1,134 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Constraints that can't be derived from the Go types
+var productSchemaRules = struct {
+	required    []string
+	readOnly    []string
+	constraints map[string]map[string]interface{}
+}{
+	required: []string{"name", "price"},
+	readOnly: []string{"id", "is_deleted", "created_at", "updated_at", "view_count"},
+	constraints: map[string]map[string]interface{}{
+		"name":           {"minLength": 1},
+		"price":          {"minimum": 0},
+		"stock_quantity": {"minimum": 0},
+	},
+}
+
+var (
+	timeType  = reflect.TypeOf(time.Time{})
+	priceType = reflect.TypeOf(Price(0))
+)
+
+// encryptedType is implemented by Encrypted[T], which encodes as a plain T
+type encryptedType interface {
+	plainType() reflect.Type
+}
+
+// numericKeywords only constrain number and integer properties
+var numericKeywords = map[string]bool{"minimum": true}
+
+// BuildSchema returns a JSON Schema (draft 2020-12) document for a struct,
+// using its json tags as property names.
+func BuildSchema(title string, model interface{}) map[string]interface{} {
+	properties := map[string]interface{}{}
+	modelType := reflect.TypeOf(model)
+	for i := 0; i < modelType.NumField(); i++ {
+		field := modelType.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" || !field.IsExported() {
+			continue
+		}
+		properties[name] = schemaForType(field.Type)
+	}
+	return map[string]interface{}{
+		"$schema":    "https://json-schema.org/draft/2020-12/schema",
+		"title":      title,
+		"type":       "object",
+		"properties": properties,
+	}
+}
+
+func schemaForType(t reflect.Type) map[string]interface{} {
+	nullable := false
+	if t.Kind() == reflect.Ptr {
+		nullable = true
+		t = t.Elem()
+	}
+	schema := map[string]interface{}{}
+	encrypted, isEncrypted := reflect.Zero(t).Interface().(encryptedType)
+	switch {
+	case isEncrypted:
+		schema = schemaForType(encrypted.plainType())
+	case t == timeType:
+		schema["type"] = "string"
+		schema["format"] = "date-time"
+	case t == priceType && config.PricesAsStrings:
+		// Encoded as decimal strings such as "19.99", see Price.MarshalJSON
+		schema["type"] = "string"
+		schema["pattern"] = `^-?[0-9]+(\.[0-9]+)?$`
+	case t.Kind() == reflect.String:
+		schema["type"] = "string"
+	case t.Kind() == reflect.Bool:
+		schema["type"] = "boolean"
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		schema["type"] = "integer"
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		schema["type"] = "number"
+	case t.Kind() == reflect.Slice:
+		schema["type"] = "array"
+		schema["items"] = schemaForType(t.Elem())
+	default:
+		schema["type"] = "object"
+	}
+	if nullable {
+		schema["type"] = []interface{}{schema["type"], "null"}
+	}
+	return schema
+}
+
+func productSchema() map[string]interface{} {
+	schema := BuildSchema("Product", Product{})
+	properties := schema["properties"].(map[string]interface{})
+	for name, constraints := range productSchemaRules.constraints {
+		property := properties[name].(map[string]interface{})
+		for key, value := range constraints {
+			if numericKeywords[key] && !isNumericSchema(property) {
+				continue
+			}
+			property[key] = value
+		}
+	}
+	for _, name := range productSchemaRules.readOnly {
+		properties[name].(map[string]interface{})["readOnly"] = true
+	}
+	schema["required"] = productSchemaRules.required
+	return schema
+}
+
+// isNumericSchema reports whether a property is a number or an integer,
+// nullable or not
+func isNumericSchema(schema map[string]interface{}) bool {
+	types, ok := schema["type"].([]interface{})
+	if !ok {
+		types = []interface{}{schema["type"]}
+	}
+	for _, t := range types {
+		if t == "number" || t == "integer" {
+			return true
+		}
+	}
+	return false
+}
+
+// Handlers
+func GetProductSchema(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, http.StatusOK, productSchema())
+}
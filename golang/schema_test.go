@@ -0,0 +1,46 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestProductSchemaFollowsPricesAsStrings(t *testing.T) {
+	previous := config.PricesAsStrings
+	t.Cleanup(func() { config.PricesAsStrings = previous })
+
+	config.PricesAsStrings = false
+	properties := productSchema()["properties"].(map[string]interface{})
+	price := properties["price"].(map[string]interface{})
+	if price["type"] != "number" || price["minimum"] != 0 {
+		t.Fatalf("price as number: got %v", price)
+	}
+
+	config.PricesAsStrings = true
+	properties = productSchema()["properties"].(map[string]interface{})
+	price = properties["price"].(map[string]interface{})
+	if price["type"] != "string" || price["pattern"] == nil {
+		t.Fatalf("price as string: got %v", price)
+	}
+	if _, ok := price["minimum"]; ok {
+		t.Fatalf("price as string kept a numeric minimum: %v", price)
+	}
+	cost := properties["cost"].(map[string]interface{})
+	if !reflect.DeepEqual(cost["type"], []interface{}{"string", "null"}) {
+		t.Fatalf("cost as string: got %v", cost)
+	}
+	if stock := properties["stock_quantity"].(map[string]interface{}); stock["minimum"] != 0 {
+		t.Fatalf("stock_quantity lost its minimum: %v", stock)
+	}
+}
+
+func TestProductSchemaDescribesEncryptedFieldsAsTheirValues(t *testing.T) {
+	properties := productSchema()["properties"].(map[string]interface{})
+	supplierCost := properties["supplier_cost"].(map[string]interface{})
+	if supplierCost["type"] != "number" {
+		t.Fatalf("supplier_cost: got %v, want a number", supplierCost)
+	}
+	if schema := schemaForType(reflect.TypeOf(Encrypted[string]{})); schema["type"] != "string" {
+		t.Fatalf("Encrypted[string]: got %v", schema)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"html"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Relevance weights for the SQLite ranking heuristic
+const (
+	nameMatchWeight        = 3
+	descriptionMatchWeight = 1
+)
+
+// Search returns a page of the products matching every term of opts.Query,
+// together with the total number of matches. With rank set they are ordered
+// by relevance, name matches weighing more than description matches, and
+// opts.Order breaks ties; otherwise opts.Order alone applies.
+func (repo *GenericRepository) Search(opts ListOptions, rank bool) ([]Product, int64, error) {
+	var products []Product
+	var total int64
+	var db *gorm.DB
+	var score string
+	var args []interface{}
+	if repo.DB.Dialector.Name() == "postgres" {
+		db, score, args = repo.searchPostgres(opts.Query)
+	} else {
+		db, score, args = repo.searchSQLite(opts.Query)
+	}
+	db = db.Scopes(inCategories(opts), priceRange(opts))
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if rank {
+		// The tie-breaker is part of the expression: a later Order call
+		// would replace an expression-based ORDER BY
+		order := "id"
+		if opts.Order != "" {
+			order = opts.Order
+		}
+		db = db.Order(orderByExpr(score+" DESC, "+order, args...))
+	} else {
+		db = db.Scopes(ordered(opts))
+	}
+	err := db.Scopes(paginate(opts)).Find(&products).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return products, total, nil
+}
+
+// searchSQLite matches the terms against search_text and scores them with
+// LIKE, returning the filtered query and the relevance expression
+func (repo *GenericRepository) searchSQLite(query string) (*gorm.DB, string, []interface{}) {
+	terms := strings.Fields(query)
+	db := repo.DB.Model(&Product{}).Where("is_deleted = ?", false)
+	var scores []string
+	var args []interface{}
+	for _, term := range terms {
+		pattern := likePattern(term)
+		db = db.Where("search_text LIKE ? ESCAPE '\\'", pattern)
+		scores = append(scores,
+			"(CASE WHEN LOWER(name) LIKE ? ESCAPE '\\' THEN ? ELSE 0 END)",
+			"(CASE WHEN LOWER(description) LIKE ? ESCAPE '\\' THEN ? ELSE 0 END)")
+		args = append(args, pattern, nameMatchWeight, pattern, descriptionMatchWeight)
+	}
+	return db, strings.Join(scores, " + "), args
+}
+
+// searchPostgres uses full-text search, with the name in the higher weight class
+func (repo *GenericRepository) searchPostgres(query string) (*gorm.DB, string, []interface{}) {
+	document := "setweight(to_tsvector('simple', name), 'A') || setweight(to_tsvector('simple', coalesce(description, '')), 'B')"
+	db := repo.DB.Model(&Product{}).Where("is_deleted = ?", false).
+		Where(document+" @@ plainto_tsquery('simple', ?)", query)
+	return db, "ts_rank(" + document + ", plainto_tsquery('simple', ?))", []interface{}{query}
+}
+
+// Markers wrapped around matches by ?highlight=true
+const (
+	highlightOpen  = "<mark>"
+	highlightClose = "</mark>"
+)
+
+// highlightMatches HTML-escapes the names and descriptions of products and
+// marks every case-insensitive occurrence of the query terms. The fields are
+// escaped as a whole, so only the markers are markup.
+func highlightMatches(products []Product, query string) {
+	terms := strings.Fields(query)
+	// Longest first, so a term that contains another wins the overlap
+	sort.Slice(terms, func(i, j int) bool { return len(terms[i]) > len(terms[j]) })
+	for i, term := range terms {
+		terms[i] = regexp.QuoteMeta(term)
+	}
+	pattern := regexp.MustCompile("(?i)" + strings.Join(terms, "|"))
+	for i := range products {
+		products[i].Name = highlight(products[i].Name, pattern)
+		products[i].Description = highlight(products[i].Description, pattern)
+	}
+}
+
+func highlight(text string, pattern *regexp.Regexp) string {
+	var marked strings.Builder
+	end := 0
+	for _, match := range pattern.FindAllStringIndex(text, -1) {
+		marked.WriteString(html.EscapeString(text[end:match[0]]))
+		marked.WriteString(highlightOpen + html.EscapeString(text[match[0]:match[1]]) + highlightClose)
+		end = match[1]
+	}
+	marked.WriteString(html.EscapeString(text[end:]))
+	return marked.String()
+}
+
+// Handlers
+func SearchProducts(w http.ResponseWriter, r *http.Request) {
+	params := NewQueryParams(r)
+	opts := parseProductListOptions(params)
+	rank := params.Bool("rank", false)
+	highlighted := params.Bool("highlight", false)
+	if opts.Query == "" {
+		params.addError("q is required")
+	}
+	if !params.Valid() {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid query parameters", params.Errors)
+		return
+	}
+	products, total, err := productRepo.WithContext(r.Context()).Search(opts, rank)
+	if err != nil {
+		http.Error(w, "Error searching products", http.StatusInternalServerError)
+		return
+	}
+	if highlighted {
+		highlightMatches(products, opts.Query)
+	}
+	meta := newPageMeta(opts, total, len(products))
+	respondWithPage(w, r, products, "Products retrieved successfully", meta)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	defaultSimilarLimit = 5
+	maxSimilarLimit     = 20
+	// Similar products cost between half and one and a half times the price
+	similarPriceBand = 0.5
+	// Shorter words ("a", "of", "xl") match too much to be useful
+	minSimilarWordLength = 3
+)
+
+// GetSimilar finds products whose names share words with the given product,
+// within its price band. Postgres ranks by trigram similarity; elsewhere the
+// score is the number of shared words.
+func (repo *GenericRepository) GetSimilar(product *Product, limit int) ([]Product, error) {
+	price := float64(product.Price)
+	query := repo.DB.Where("id <> ? AND is_deleted = ?", product.ID, false).
+		Where("price BETWEEN ? AND ?", price*(1-similarPriceBand), price*(1+similarPriceBand)).
+		Limit(limit)
+
+	var products []Product
+	if repo.DB.Dialector.Name() == "postgres" {
+		err := query.Where("similarity(name, ?) > 0.2", product.Name).
+			Order(orderByExpr("similarity(name, ?) DESC", product.Name)).
+			Find(&products).Error
+		return products, err
+	}
+
+	var words []string
+	for _, word := range strings.Fields(strings.ToLower(product.Name)) {
+		if len(word) >= minSimilarWordLength {
+			words = append(words, word)
+		}
+	}
+	if len(words) == 0 {
+		return products, nil
+	}
+	conditions := make([]string, len(words))
+	scores := make([]string, len(words))
+	args := make([]interface{}, len(words))
+	for i, word := range words {
+		conditions[i] = "LOWER(name) LIKE ? ESCAPE '\\'"
+		scores[i] = "(CASE WHEN LOWER(name) LIKE ? ESCAPE '\\' THEN 1 ELSE 0 END)"
+		args[i] = likePattern(word)
+	}
+	err := query.Where(strings.Join(conditions, " OR "), args...).
+		Order(orderByExpr(strings.Join(scores, " + ")+" DESC, id", args...)).
+		Find(&products).Error
+	return products, err
+}
+
+// orderByExpr builds an ORDER BY with bound parameters, which Order doesn't
+// accept as a plain string
+func orderByExpr(sql string, args ...interface{}) clause.OrderBy {
+	return clause.OrderBy{Expression: clause.Expr{SQL: sql, Vars: args, WithoutParentheses: true}}
+}
+
+// Handlers
+func GetSimilarProducts(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	productID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+	params := NewQueryParams(r)
+	limit := params.Int("limit", defaultSimilarLimit, 1, maxSimilarLimit)
+	if !params.Valid() {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid query parameters", params.Errors)
+		return
+	}
+	product, err := productRepo.WithContext(r.Context()).GetById(uint(productID))
+	if err != nil {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+	products, err := productRepo.WithContext(r.Context()).GetSimilar(product, limit)
+	if err != nil {
+		http.Error(w, "Error fetching similar products", http.StatusInternalServerError)
+		return
+	}
+	response := ApiResponse{Success: true, Data: products, Message: "Similar products retrieved successfully"}
+	respondWithJSON(w, r, response)
+}
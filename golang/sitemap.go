@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// The sitemap protocol caps a sitemap at 50,000 URLs
+	sitemapMaxURLs   = 50000
+	sitemapNamespace = "http://www.sitemaps.org/schemas/sitemap/0.9"
+)
+
+type sitemapURL struct {
+	XMLName xml.Name `xml:"url"`
+	Loc     string   `xml:"loc"`
+	LastMod string   `xml:"lastmod"`
+}
+
+type sitemapEntry struct {
+	Loc string `xml:"loc"`
+}
+
+type sitemapIndex struct {
+	XMLName  xml.Name       `xml:"sitemapindex"`
+	Xmlns    string         `xml:"xmlns,attr"`
+	Sitemaps []sitemapEntry `xml:"sitemap"`
+}
+
+// Handlers
+
+// GetSitemap lists every active product with its last update. Catalogs over
+// sitemapMaxURLs get a sitemap index instead, pointing at ?page=N sitemaps.
+func GetSitemap(w http.ResponseWriter, r *http.Request) {
+	params := NewQueryParams(r)
+	page := params.Int("page", 0, 1, math.MaxInt32)
+	if !params.Valid() {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid query parameters", params.Errors)
+		return
+	}
+	repo := productRepo.WithContext(r.Context())
+	query := repo.DB.Model(&Product{}).Where("is_deleted = ?", false)
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		http.Error(w, "Error building sitemap", http.StatusInternalServerError)
+		return
+	}
+	pages := int((total + sitemapMaxURLs - 1) / sitemapMaxURLs)
+	base := requestBaseURL(r)
+
+	if page == 0 && pages > 1 {
+		index := sitemapIndex{Xmlns: sitemapNamespace}
+		for i := 1; i <= pages; i++ {
+			index.Sitemaps = append(index.Sitemaps, sitemapEntry{Loc: fmt.Sprintf("%s/sitemap.xml?page=%d", base, i)})
+		}
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		w.Write([]byte(xml.Header))
+		encoder := xml.NewEncoder(w)
+		encoder.Indent("", "  ")
+		encoder.Encode(index)
+		return
+	}
+	if page == 0 {
+		page = 1
+	}
+	if page > 1 && page > pages {
+		http.Error(w, "Sitemap page not found", http.StatusNotFound)
+		return
+	}
+
+	rows, err := query.Select("id", "updated_at").Order("id").
+		Offset((page - 1) * sitemapMaxURLs).Limit(sitemapMaxURLs).Rows()
+	if err != nil {
+		http.Error(w, "Error building sitemap", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	// Written as the rows are read, since a full page is 50,000 entries
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.Write([]byte(xml.Header))
+	w.Write([]byte(`<urlset xmlns="` + sitemapNamespace + `">`))
+	encoder := xml.NewEncoder(w)
+	for rows.Next() {
+		var product Product
+		if err := repo.DB.ScanRows(rows, &product); err != nil {
+			log.Println("Error scanning sitemap product: ", err)
+			return
+		}
+		encoder.Encode(sitemapURL{
+			Loc:     base + "/products/" + strconv.FormatUint(uint64(product.ID), 10),
+			LastMod: product.UpdatedAt.UTC().Format(time.RFC3339),
+		})
+	}
+	encoder.Flush()
+	w.Write([]byte("</urlset>\n"))
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+type Availability struct {
+	Available bool `json:"available"`
+	InStock   int  `json:"in_stock"`
+	// Reserved units are in stock but held by checkouts
+	Reserved int `json:"reserved"`
+	// Warehouse is set when availability was checked at one warehouse;
+	// InStock is then that warehouse's stock
+	Warehouse string `json:"warehouse,omitempty"`
+}
+
+// GetStock reads only the stock column, skipping the rest of the row
+func (repo *GenericRepository) GetStock(id uint) (int, error) {
+	var product Product
+	err := repo.DB.Select("stock_quantity").
+		Where("id = ? AND is_deleted = ?", id, false).
+		First(&product).Error
+	if err != nil {
+		return 0, err
+	}
+	return product.StockQuantity, nil
+}
+
+const maxStockBatchSize = 500
+
+var (
+	ErrInsufficientStock = errors.New("insufficient stock")
+	errBatchFailed       = errors.New("batch failed")
+)
+
+// AdjustStock applies a delta in a single UPDATE that refuses to take the
+// stock below zero, or below what its warehouses hold, and returns the
+// resulting quantity. The change is recorded in the stock ledger.
+func (repo *GenericRepository) AdjustStock(id uint, delta int, reason string) (int, error) {
+	return repo.adjustStock(StockMovement{ProductID: id, Delta: delta, Reason: reason})
+}
+
+func (repo *GenericRepository) adjustStock(movement StockMovement) (int, error) {
+	id, delta := movement.ProductID, movement.Delta
+	var stock int
+	err := repo.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		stock, err = (&GenericRepository{DB: tx}).applyStockDelta(id, delta)
+		if err != nil {
+			return err
+		}
+		movement.Quantity = stock
+		return tx.Create(&movement).Error
+	})
+	return stock, err
+}
+
+func (repo *GenericRepository) applyStockDelta(id uint, delta int) (int, error) {
+	result := repo.DB.Model(&Product{}).
+		Where("id = ? AND is_deleted = ? AND stock_quantity + ? >= 0", id, false, delta).
+		Where("stock_quantity + ? >= (SELECT COALESCE(SUM(quantity), 0) FROM warehouse_stocks WHERE product_id = products.id)", delta).
+		UpdateColumns(map[string]interface{}{
+			"stock_quantity": gorm.Expr("stock_quantity + ?", delta),
+			"updated_at":     time.Now().UTC(),
+		})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	stock, err := repo.GetStock(id)
+	if err != nil {
+		return 0, err
+	}
+	if result.RowsAffected == 0 {
+		return stock, ErrInsufficientStock
+	}
+	return stock, nil
+}
+
+type StockAdjustment struct {
+	ID    uint `json:"id"`
+	Delta int  `json:"delta"`
+	// Reason is kept in the stock ledger, e.g. "received shipment"
+	Reason string `json:"reason,omitempty"`
+	// Warehouse targets one warehouse's stock; without it only the
+	// unassigned part of the total changes
+	Warehouse string `json:"warehouse,omitempty"`
+}
+
+type StockAdjustmentResult struct {
+	ID                uint   `json:"id"`
+	Delta             int    `json:"delta"`
+	Warehouse         string `json:"warehouse,omitempty"`
+	StockQuantity     *int   `json:"stock_quantity,omitempty"`
+	WarehouseQuantity *int   `json:"warehouse_quantity,omitempty"`
+	Error             string `json:"error,omitempty"`
+}
+
+// AdjustStockBatch applies all adjustments in one transaction. Unless
+// bestEffort is set, any failing item rolls back the whole batch.
+func (repo *GenericRepository) AdjustStockBatch(adjustments []StockAdjustment, bestEffort bool) ([]StockAdjustmentResult, error) {
+	results := make([]StockAdjustmentResult, len(adjustments))
+	err := repo.DB.Transaction(func(tx *gorm.DB) error {
+		txRepo := &GenericRepository{DB: tx}
+		failed := false
+		for i, adjustment := range adjustments {
+			warehouse := strings.TrimSpace(adjustment.Warehouse)
+			results[i] = StockAdjustmentResult{ID: adjustment.ID, Delta: adjustment.Delta, Warehouse: warehouse}
+			var stock, warehouseStock int
+			var err error
+			if warehouse == "" {
+				stock, err = txRepo.AdjustStock(adjustment.ID, adjustment.Delta, adjustment.Reason)
+			} else {
+				stock, warehouseStock, err = txRepo.AdjustWarehouseStock(adjustment.ID, warehouse, adjustment.Delta, adjustment.Reason)
+			}
+			switch {
+			case errors.Is(err, gorm.ErrRecordNotFound):
+				results[i].Error = "product not found"
+				failed = true
+			case errors.Is(err, ErrInsufficientStock) && warehouse != "":
+				results[i].Error = fmt.Sprintf("insufficient stock at %s (%d available)", warehouse, warehouseStock)
+				failed = true
+			case errors.Is(err, ErrInsufficientStock):
+				results[i].Error = fmt.Sprintf("insufficient stock (%d available)", stock)
+				failed = true
+			case err != nil:
+				return err
+			default:
+				results[i].StockQuantity = &stock
+				if warehouse != "" {
+					results[i].WarehouseQuantity = &warehouseStock
+				}
+			}
+		}
+		if failed && !bestEffort {
+			return errBatchFailed
+		}
+		return nil
+	})
+	return results, err
+}
+
+// Handlers
+func AdjustStockBatch(w http.ResponseWriter, r *http.Request) {
+	params := NewQueryParams(r)
+	bestEffort := params.Bool("best_effort", false)
+	if !params.Valid() {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid query parameters", params.Errors)
+		return
+	}
+	var adjustments []StockAdjustment
+	if err := decodeBody(r, &adjustments); err != nil {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid input", []string{err.Error()})
+		return
+	}
+	if len(adjustments) == 0 || len(adjustments) > maxStockBatchSize {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid input", []string{fmt.Sprintf("batch must contain between 1 and %d adjustments", maxStockBatchSize)})
+		return
+	}
+	for i := range adjustments {
+		adjustments[i].Reason = strings.TrimSpace(adjustments[i].Reason)
+		if len(adjustments[i].Reason) > maxMovementReasonLength {
+			respondWithError(w, r, http.StatusBadRequest, "Invalid input", []string{fmt.Sprintf("item %d: reason must be at most %d characters", i, maxMovementReasonLength)})
+			return
+		}
+	}
+	results, err := productRepo.WithContext(r.Context()).AdjustStockBatch(adjustments, bestEffort)
+	if errors.Is(err, errBatchFailed) {
+		var errs []string
+		for i, result := range results {
+			if result.Error != "" {
+				errs = append(errs, fmt.Sprintf("item %d (product %d): %s", i, result.ID, result.Error))
+			}
+		}
+		respondWithError(w, r, http.StatusConflict, "Stock batch rolled back", errs)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error adjusting stock", http.StatusInternalServerError)
+		return
+	}
+	for _, result := range results {
+		if result.Error == "" {
+			auditChanges(r.Context(), []uint{result.ID}, AuditStockAdjusted, result)
+		}
+	}
+	response := ApiResponse{Success: true, Data: results, Message: "Stock adjusted successfully"}
+	respondWithJSON(w, r, response)
+}
+
+func GetProductAvailability(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	productID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+	params := NewQueryParams(r)
+	quantity := params.Int("quantity", 1, 1, math.MaxInt32)
+	warehouse := strings.TrimSpace(params.values.Get("warehouse"))
+	if !params.Valid() {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid query parameters", params.Errors)
+		return
+	}
+	repo := productRepo.WithContext(r.Context())
+	stock, err := repo.GetStock(uint(productID))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error checking availability", http.StatusInternalServerError)
+		return
+	}
+	reserved, err := repo.GetReserved(uint(productID))
+	if err != nil {
+		http.Error(w, "Error checking availability", http.StatusInternalServerError)
+		return
+	}
+	availability := Availability{Available: stock-reserved >= quantity, InStock: stock, Reserved: reserved}
+	if warehouse != "" {
+		// Reservations aren't tied to a warehouse, so they still limit the
+		// total on top of what the warehouse holds
+		warehouseStock, err := repo.GetWarehouseStock(uint(productID), warehouse)
+		if err != nil {
+			http.Error(w, "Error checking availability", http.StatusInternalServerError)
+			return
+		}
+		availability.Available = availability.Available && warehouseStock >= quantity
+		availability.InStock = warehouseStock
+		availability.Warehouse = warehouse
+	}
+	response := ApiResponse{Success: true, Data: availability, Message: "Availability retrieved successfully"}
+	respondWithJSON(w, r, response)
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+)
+
+// ProductStore is the storage the product CRUD handlers depend on.
+// GenericRepository is the GORM implementation and MemoryProductStore keeps
+// everything in a map. Not found is reported as gorm.ErrRecordNotFound by
+// every implementation so handlers can check a single error.
+//
+// Update calls check with the product it's about to replace, or nil when
+// upserting a new one, in the same transaction or lock as the write; an
+// error from check aborts the update and is returned as is.
+type ProductStore interface {
+	GetAll(opts ListOptions) ([]Product, int64, error)
+	GetById(id uint) (*Product, error)
+	GetByIds(ids []uint) (map[uint]Product, error)
+	Create(product *Product) (*Product, error)
+	Update(product *Product, upsert bool, check func(stored *Product) error) (*Product, *Product, error)
+	Delete(id uint, reason string) (bool, error)
+}
+
+var (
+	_ ProductStore = (*GenericRepository)(nil)
+	_ ProductStore = (*MemoryProductStore)(nil)
+)
+
+// productStore returns the store to use for a request. Replace it to run
+// the handlers against another backend.
+var productStore = func(ctx context.Context) ProductStore {
+	return productRepo.WithContext(ctx)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+)
+
+// ProductSummary is the lightweight shape of list screens on mobile
+type ProductSummary struct {
+	ID       uint    `json:"id"`
+	Name     string  `json:"name"`
+	Price    Price   `json:"price"`
+	ImageURL *string `json:"image_url"`
+	InStock  bool    `json:"in_stock"`
+}
+
+// firstImageJoin joins each product's first image. Its columns are renamed
+// so the list filters and sort fields stay unambiguous.
+const firstImageJoin = `LEFT JOIN (
+	SELECT product_id AS image_product_id, url AS image_url,
+		ROW_NUMBER() OVER (PARTITION BY product_id ORDER BY position, id) AS image_rank
+	FROM product_images
+) first_images ON first_images.image_product_id = products.id AND first_images.image_rank = 1`
+
+// GetSummaries lists products like GetAll but selects only the summary
+// columns, scanning straight into ProductSummary
+func (repo *GenericRepository) GetSummaries(opts ListOptions) ([]ProductSummary, int64, error) {
+	var total int64
+	if err := listQuery(repo.DB, opts).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	summaries := []ProductSummary{}
+	err := listQuery(repo.DB, opts).
+		Select("products.id, products.name, products.price, first_images.image_url, products.stock_quantity > 0 AS in_stock").
+		Joins(firstImageJoin).
+		Scopes(ordered(opts), paginate(opts)).
+		Scan(&summaries).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return summaries, total, nil
+}
+
+// Handlers
+func GetProductSummaries(w http.ResponseWriter, r *http.Request) {
+	params := NewQueryParams(r)
+	opts := parseProductListOptions(params)
+	if !params.Valid() {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid query parameters", params.Errors)
+		return
+	}
+	summaries, total, err := productRepo.WithContext(r.Context()).GetSummaries(opts)
+	if err != nil {
+		http.Error(w, "Error fetching products", http.StatusInternalServerError)
+		return
+	}
+	meta := newPageMeta(opts, total, len(summaries))
+	respondWithPage(w, r, summaries, "Products retrieved successfully", meta)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const maxBulkTags = 20
+
+// ProductFilter selects products for bulk operations with the same rules as
+// the list filters
+type ProductFilter struct {
+	CategoryIDs []uint   `json:"category_ids"`
+	Query       string   `json:"q"`
+	MinPrice    *float64 `json:"min_price"`
+	MaxPrice    *float64 `json:"max_price"`
+}
+
+func (filter ProductFilter) listOptions() ListOptions {
+	return ListOptions{
+		CategoryIDs: filter.CategoryIDs,
+		Query:       strings.TrimSpace(filter.Query),
+		MinPrice:    filter.MinPrice,
+		MaxPrice:    filter.MaxPrice,
+	}
+}
+
+func (filter ProductFilter) IsEmpty() bool {
+	return len(filter.CategoryIDs) == 0 && strings.TrimSpace(filter.Query) == "" && filter.MinPrice == nil && filter.MaxPrice == nil
+}
+
+type BulkTagResult struct {
+	Products int64    `json:"products"`
+	Tags     []string `json:"tags"`
+	// Added counts new product/tag pairs; products that already had a tag
+	// are matched but not added again
+	Added int64 `json:"added"`
+}
+
+// TagProducts attaches the named tags, creating missing ones, to every
+// active product matching the filter in one transaction
+func (repo *GenericRepository) TagProducts(filter ProductFilter, names []string) (*BulkTagResult, error) {
+	result := &BulkTagResult{Tags: names}
+	opts := filter.listOptions()
+	err := repo.DB.Transaction(func(tx *gorm.DB) error {
+		tags := make([]Tag, len(names))
+		for i, name := range names {
+			tags[i] = Tag{Name: name}
+		}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&tags).Error; err != nil {
+			return err
+		}
+		var tagIDs []uint
+		if err := tx.Model(&Tag{}).Where("name IN ?", names).Pluck("id", &tagIDs).Error; err != nil {
+			return err
+		}
+
+		var productIDs []uint
+		err := tx.Model(&Product{}).Where("is_deleted = ?", false).
+			Scopes(nameSearch(opts), inCategories(opts), priceRange(opts)).
+			Order("id").Pluck("id", &productIDs).Error
+		if err != nil {
+			return err
+		}
+		result.Products = int64(len(productIDs))
+		if len(productIDs) == 0 {
+			return nil
+		}
+
+		links := make([]ProductTag, 0, len(productIDs)*len(tagIDs))
+		for _, productID := range productIDs {
+			for _, tagID := range tagIDs {
+				links = append(links, ProductTag{ProductID: productID, TagID: tagID})
+			}
+		}
+		created := tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(&links, 500)
+		result.Added = created.RowsAffected
+		if created.Error != nil {
+			return created.Error
+		}
+		writeAudit(tx, productIDs, AuditTagsAdded, map[string][]string{"tags": names})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+type bulkTagRequest struct {
+	Filter ProductFilter `json:"filter"`
+	Tags   []string      `json:"tags"`
+}
+
+// normalizeTagNames trims names and drops blanks and duplicates
+func normalizeTagNames(names []string) []string {
+	var normalized []string
+	seen := map[string]bool{}
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name != "" && !seen[name] {
+			seen[name] = true
+			normalized = append(normalized, name)
+		}
+	}
+	return normalized
+}
+
+// Handlers
+func BulkTagProducts(w http.ResponseWriter, r *http.Request) {
+	var request bulkTagRequest
+	if err := decodeBody(r, &request); err != nil {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid input", []string{err.Error()})
+		return
+	}
+	names := normalizeTagNames(request.Tags)
+	var errs []string
+	if len(names) == 0 || len(names) > maxBulkTags {
+		errs = append(errs, fmt.Sprintf("tags must contain between 1 and %d names", maxBulkTags))
+	}
+	// Tagging the whole catalog takes an explicit filter
+	if request.Filter.IsEmpty() {
+		errs = append(errs, "filter must set at least one of category_ids, q, min_price or max_price")
+	}
+	if len(errs) > 0 {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid input", errs)
+		return
+	}
+	result, err := productRepo.WithContext(r.Context()).TagProducts(request.Filter, names)
+	if err != nil {
+		http.Error(w, "Error tagging products", http.StatusInternalServerError)
+		return
+	}
+	message := fmt.Sprintf("%d products tagged", result.Products)
+	response := ApiResponse{Success: true, Data: result, Message: message}
+	respondWithJSON(w, r, response)
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// PriceTier is a volume discount: orders of at least MinQuantity pay
+// UnitPrice per unit, up to the next tier
+type PriceTier struct {
+	ID          uint  `json:"id"`
+	ProductID   uint  `json:"product_id" gorm:"uniqueIndex:idx_product_min_quantity;not null"`
+	MinQuantity int   `json:"min_quantity" gorm:"uniqueIndex:idx_product_min_quantity;not null"`
+	UnitPrice   Price `json:"unit_price"`
+}
+
+type TierPrice struct {
+	Quantity  int        `json:"quantity"`
+	BasePrice Price      `json:"base_price"`
+	UnitPrice Price      `json:"unit_price"`
+	Total     Price      `json:"total"`
+	Tier      *PriceTier `json:"tier"`
+}
+
+// validateTiers checks a product's complete set of tiers: quantities are
+// distinct and at least 2, and a larger quantity never costs more per unit
+func validateTiers(tiers []PriceTier) []string {
+	sorted := append([]PriceTier{}, tiers...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].MinQuantity < sorted[j].MinQuantity })
+	var errs []string
+	for i, tier := range sorted {
+		if tier.MinQuantity < 2 {
+			errs = append(errs, "min_quantity must be at least 2")
+		}
+		if tier.UnitPrice < 0 {
+			errs = append(errs, "unit_price must not be negative")
+		}
+		if i == 0 {
+			continue
+		}
+		previous := sorted[i-1]
+		if tier.MinQuantity == previous.MinQuantity {
+			errs = append(errs, fmt.Sprintf("two tiers start at quantity %d", tier.MinQuantity))
+		} else if tier.UnitPrice > previous.UnitPrice {
+			errs = append(errs, fmt.Sprintf("tier at quantity %d costs more than the tier at %d", tier.MinQuantity, previous.MinQuantity))
+		}
+	}
+	return errs
+}
+
+// TierError carries the validation messages of a rejected tier change
+type TierError struct {
+	Errors []string
+}
+
+func (e *TierError) Error() string {
+	return "invalid price tiers"
+}
+
+func (repo *GenericRepository) GetTiers(productID uint) ([]PriceTier, error) {
+	tiers := []PriceTier{}
+	err := repo.DB.Where("product_id = ?", productID).Order("min_quantity").Find(&tiers).Error
+	return tiers, err
+}
+
+// changeTiers applies a change to a product's tiers in a transaction and
+// rolls it back unless the resulting set is valid
+func (repo *GenericRepository) changeTiers(productID uint, change func(tx *gorm.DB) error) error {
+	return repo.DB.Transaction(func(tx *gorm.DB) error {
+		txRepo := &GenericRepository{DB: tx}
+		if _, err := txRepo.GetById(productID); err != nil {
+			return err
+		}
+		if err := change(tx); err != nil {
+			return err
+		}
+		tiers, err := txRepo.GetTiers(productID)
+		if err != nil {
+			return err
+		}
+		if errs := validateTiers(tiers); len(errs) > 0 {
+			return &TierError{Errors: errs}
+		}
+		return nil
+	})
+}
+
+func (repo *GenericRepository) CreateTier(tier *PriceTier) error {
+	return repo.changeTiers(tier.ProductID, func(tx *gorm.DB) error {
+		return tx.Create(tier).Error
+	})
+}
+
+func (repo *GenericRepository) UpdateTier(tier *PriceTier) error {
+	return repo.changeTiers(tier.ProductID, func(tx *gorm.DB) error {
+		result := tx.Model(&PriceTier{}).Where("id = ? AND product_id = ?", tier.ID, tier.ProductID).
+			Select("min_quantity", "unit_price").Updates(tier)
+		if result.Error == nil && result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return result.Error
+	})
+}
+
+func (repo *GenericRepository) DeleteTier(productID, tierID uint) error {
+	return repo.changeTiers(productID, func(tx *gorm.DB) error {
+		result := tx.Where("id = ? AND product_id = ?", tierID, productID).Delete(&PriceTier{})
+		if result.Error == nil && result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return result.Error
+	})
+}
+
+// GetTierPrice prices a quantity with the highest tier it reaches, or the
+// product's own price below the first tier
+func (repo *GenericRepository) GetTierPrice(productID uint, quantity int) (*TierPrice, error) {
+	product, err := repo.GetById(productID)
+	if err != nil {
+		return nil, err
+	}
+	price := &TierPrice{Quantity: quantity, BasePrice: product.Price, UnitPrice: product.Price}
+	var tier PriceTier
+	err = repo.DB.Where("product_id = ? AND min_quantity <= ?", productID, quantity).
+		Order("min_quantity DESC").First(&tier).Error
+	switch {
+	case err == nil:
+		price.Tier = &tier
+		price.UnitPrice = tier.UnitPrice
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, err
+	}
+	price.Total = Price(math.Round(float64(price.UnitPrice)*float64(quantity)*100) / 100)
+	return price, nil
+}
+
+// respondWithTierError maps tier repository errors to responses and reports
+// whether there was one
+func respondWithTierError(w http.ResponseWriter, r *http.Request, err error) bool {
+	var tierErr *TierError
+	switch {
+	case err == nil:
+		return false
+	case errors.As(err, &tierErr):
+		respondWithError(w, r, http.StatusUnprocessableEntity, "Invalid price tiers", tierErr.Errors)
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		respondWithError(w, r, http.StatusUnprocessableEntity, "Invalid price tiers", []string{"a tier already starts at this quantity"})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		http.Error(w, "Product or price tier not found", http.StatusNotFound)
+	default:
+		http.Error(w, "Error saving price tier", http.StatusInternalServerError)
+	}
+	return true
+}
+
+// Handlers
+func GetProductPrice(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	productID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+	params := NewQueryParams(r)
+	quantity := params.Int("quantity", 1, 1, math.MaxInt32)
+	if !params.Valid() {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid query parameters", params.Errors)
+		return
+	}
+	price, err := productRepo.WithContext(r.Context()).GetTierPrice(uint(productID), quantity)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error pricing product", http.StatusInternalServerError)
+		return
+	}
+	response := ApiResponse{Success: true, Data: price, Message: "Price retrieved successfully"}
+	respondWithJSON(w, r, response)
+}
+
+func GetProductTiers(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	productID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+	repo := productRepo.WithContext(r.Context())
+	if _, err := repo.GetById(uint(productID)); err != nil {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+	tiers, err := repo.GetTiers(uint(productID))
+	if err != nil {
+		http.Error(w, "Error fetching price tiers", http.StatusInternalServerError)
+		return
+	}
+	response := ApiResponse{Success: true, Data: tiers, Message: "Price tiers retrieved successfully"}
+	respondWithJSON(w, r, response)
+}
+
+func CreateProductTier(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	productID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+	var tier PriceTier
+	if err := decodeBody(r, &tier); err != nil {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid input", []string{err.Error()})
+		return
+	}
+	tier.ID = 0
+	tier.ProductID = uint(productID)
+	if respondWithTierError(w, r, productRepo.WithContext(r.Context()).CreateTier(&tier)) {
+		return
+	}
+	auditChanges(r.Context(), []uint{tier.ProductID}, AuditTierCreated, tier)
+	response := ApiResponse{Success: true, Data: tier, Message: "Price tier created successfully"}
+	respondWithJSONStatus(w, r, http.StatusCreated, response)
+}
+
+func UpdateProductTier(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	productID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+	tierID, err := strconv.Atoi(vars["tierId"])
+	if err != nil {
+		http.Error(w, "Invalid tier ID", http.StatusBadRequest)
+		return
+	}
+	var tier PriceTier
+	if err := decodeBody(r, &tier); err != nil {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid input", []string{err.Error()})
+		return
+	}
+	tier.ID = uint(tierID)
+	tier.ProductID = uint(productID)
+	if respondWithTierError(w, r, productRepo.WithContext(r.Context()).UpdateTier(&tier)) {
+		return
+	}
+	auditChanges(r.Context(), []uint{tier.ProductID}, AuditTierUpdated, tier)
+	response := ApiResponse{Success: true, Data: tier, Message: "Price tier updated successfully"}
+	respondWithJSON(w, r, response)
+}
+
+func DeleteProductTier(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	productID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+	tierID, err := strconv.Atoi(vars["tierId"])
+	if err != nil {
+		http.Error(w, "Invalid tier ID", http.StatusBadRequest)
+		return
+	}
+	if respondWithTierError(w, r, productRepo.WithContext(r.Context()).DeleteTier(uint(productID), uint(tierID))) {
+		return
+	}
+	auditChanges(r.Context(), []uint{uint(productID)}, AuditTierDeleted, map[string]uint{"id": uint(tierID)})
+	response := ApiResponse{Success: true, Message: "Price tier deleted successfully"}
+	respondWithJSON(w, r, response)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// Streaming routes, which may legitimately outlast REQUEST_TIMEOUT and need
+// to flush as they go, which neither http.TimeoutHandler nor the read-only
+// buffering allow
+var streamingRoutes = map[string]bool{
+	"/products/export":        true,
+	"/products/stream-import": true,
+	"/sitemap.xml":            true,
+}
+
+func isStreamingRoute(r *http.Request) bool {
+	current := mux.CurrentRoute(r)
+	if current == nil {
+		return false
+	}
+	template, err := current.GetPathTemplate()
+	return err == nil && streamingRoutes[template]
+}
+
+// TimeoutMiddleware answers 503 when a handler takes longer than
+// REQUEST_TIMEOUT. The request context is cancelled too, so the handler's
+// queries are abandoned rather than left running. Zero disables the limit.
+func TimeoutMiddleware(next http.Handler) http.Handler {
+	if config.RequestTimeout <= 0 {
+		return next
+	}
+	timed := http.TimeoutHandler(next, config.RequestTimeout, "Request timed out\n")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isStreamingRoute(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		timed.ServeHTTP(w, r)
+	})
+}
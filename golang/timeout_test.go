@@ -0,0 +1,33 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestTimeoutSkipsStreamingRoutes(t *testing.T) {
+	previous := config.RequestTimeout
+	config.RequestTimeout = 10 * time.Millisecond
+	t.Cleanup(func() { config.RequestTimeout = previous })
+
+	slow := func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte("done"))
+	}
+	r := mux.NewRouter()
+	r.Use(TimeoutMiddleware)
+	r.HandleFunc("/sitemap.xml", slow)
+	r.HandleFunc("/products", slow)
+
+	for path, want := range map[string]int{"/sitemap.xml": http.StatusOK, "/products": http.StatusServiceUnavailable} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != want {
+			t.Errorf("%s: got %d, want %d", path, w.Code, want)
+		}
+	}
+}
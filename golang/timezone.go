@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Timestamps are stored in UTC. Clients can have them returned in another
+// zone with ?tz=America/Sao_Paulo or the X-Timezone header.
+
+const locationContextKey contextKey = "location"
+
+// Response fields converted to the requested zone
+var localTimestamp = regexp.MustCompile(`"(created_at|updated_at)":(\s*)"([^"\\]+)"`)
+
+// utcNow is gorm's clock, so automatic timestamps are stored in UTC too
+func utcNow() time.Time {
+	return time.Now().UTC()
+}
+
+// TimezoneMiddleware rejects unknown zone names before the handler runs
+func TimezoneMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "X-Timezone")
+		name := strings.TrimSpace(r.URL.Query().Get("tz"))
+		if name == "" {
+			name = strings.TrimSpace(r.Header.Get("X-Timezone"))
+		}
+		if name == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// LoadLocation also accepts "Local", which would be the server's zone
+		location, err := time.LoadLocation(name)
+		if err != nil || name == "Local" {
+			respondWithError(w, r, http.StatusBadRequest, "Invalid timezone", []string{"unknown timezone " + name})
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), locationContextKey, location)))
+	})
+}
+
+// inRequestTimezone rewrites the timestamps of an encoded response in the zone
+// the request asked for, leaving everything else byte for byte
+func inRequestTimezone(r *http.Request, body []byte) []byte {
+	location, ok := r.Context().Value(locationContextKey).(*time.Location)
+	if !ok {
+		return body
+	}
+	return localTimestamp.ReplaceAllFunc(body, func(match []byte) []byte {
+		parts := localTimestamp.FindSubmatch(match)
+		t, err := time.Parse(time.RFC3339Nano, string(parts[3]))
+		if err != nil {
+			return match
+		}
+		return []byte(`"` + string(parts[1]) + `":` + string(parts[2]) + `"` + t.In(location).Format(time.RFC3339Nano) + `"`)
+	})
+}
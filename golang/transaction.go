@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"gorm.io/gorm"
+)
+
+const transactionContextKey contextKey = "transaction"
+
+// requestTransaction is the transaction of a Transactional request. Events
+// wait for the commit, so subscribers never hear of rolled back changes.
+type requestTransaction struct {
+	tx     *gorm.DB
+	events []pendingEvent
+}
+
+type pendingEvent struct {
+	eventType string
+	payload   interface{}
+}
+
+// transactionFromContext returns the request's transaction, or nil outside
+// of Transactional handlers
+func transactionFromContext(ctx context.Context) *gorm.DB {
+	if state, ok := ctx.Value(transactionContextKey).(*requestTransaction); ok {
+		return state.tx
+	}
+	return nil
+}
+
+// Transactional runs a handler in one database transaction. Repositories
+// scoped with WithContext(r.Context()) pick it up, so every write the handler
+// makes is committed together when it answers 2xx, and rolled back on any
+// other status or a panic. The response is held back until the commit, as
+// a failed commit turns it into a 500.
+func Transactional(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tx := productRepo.DB.WithContext(r.Context()).Begin()
+		if tx.Error != nil {
+			http.Error(w, "Error starting transaction", http.StatusInternalServerError)
+			return
+		}
+		state := &requestTransaction{tx: tx}
+		buffered := &bufferedResponse{header: http.Header{}}
+		defer func() {
+			if p := recover(); p != nil {
+				tx.Rollback()
+				panic(p)
+			}
+		}()
+		next(buffered, r.WithContext(context.WithValue(r.Context(), transactionContextKey, state)))
+
+		if buffered.status == 0 {
+			buffered.status = http.StatusOK
+		}
+		if buffered.status < 200 || buffered.status > 299 {
+			tx.Rollback()
+		} else if err := tx.Commit().Error; err != nil {
+			log.Println("Error committing request transaction: ", err)
+			http.Error(w, "Error saving changes", http.StatusInternalServerError)
+			return
+		} else {
+			for _, event := range state.events {
+				publishEvent(event.eventType, event.payload)
+			}
+		}
+		for key, values := range buffered.header {
+			w.Header()[key] = values
+		}
+		w.WriteHeader(buffered.status)
+		w.Write(buffered.body.Bytes())
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestTransactionalRollsBackFailedRequests(t *testing.T) {
+	setupTestDB(t)
+	handler := Transactional(func(w http.ResponseWriter, r *http.Request) {
+		product := Product{Name: "Widget", SKU: "W-1", Price: 5}
+		if _, err := productRepo.WithContext(r.Context()).Create(&product); err != nil {
+			t.Fatal(err)
+		}
+		emitEvent(r.Context(), EventProductCreated, &product)
+		respondWithError(w, r, http.StatusConflict, "Changed my mind", nil)
+	})
+	if w := serve(handler, "POST", "/products", nil, nil); w.Code != http.StatusConflict {
+		t.Fatalf("got %d: %s", w.Code, w.Body)
+	}
+	var products, entries int64
+	db.Model(&Product{}).Count(&products)
+	db.Model(&AuditEntry{}).Count(&entries)
+	if products != 0 || entries != 0 {
+		t.Fatalf("rolled back request left %d products and %d audit entries", products, entries)
+	}
+}
+
+func TestTransactionalCommitsWritesWithTheirAudit(t *testing.T) {
+	setupTestDB(t)
+	w := serve(Transactional(CreateProduct), "POST", "/products", map[string]interface{}{"name": "Widget", "sku": "W-1", "price": 5}, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("create: got %d: %s", w.Code, w.Body)
+	}
+	product := decodeProduct(t, w)
+	if _, err := productRepo.WithContext(context.Background()).GetById(product.ID); err != nil {
+		t.Fatalf("committed product: %v", err)
+	}
+	if actions := auditActions(t, product.ID); !hasAction(actions, EventProductCreated) {
+		t.Fatalf("no %s entry in %v", EventProductCreated, actions)
+	}
+}
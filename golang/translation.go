@@ -0,0 +1,287 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ProductTranslation overrides a product's name and description for one
+// locale. Empty fields fall back to the base product.
+type ProductTranslation struct {
+	ID          uint      `json:"id"`
+	ProductID   uint      `json:"product_id" gorm:"uniqueIndex:idx_product_locale;not null"`
+	Locale      string    `json:"locale" gorm:"uniqueIndex:idx_product_locale;not null"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+var localePattern = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{2,8})*$`)
+
+// normalizeLocale lowercases a tag and accepts "_" as separator, so "pt_BR"
+// and "pt-br" are the same locale. It returns "" for anything invalid.
+func normalizeLocale(raw string) string {
+	locale := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(raw), "_", "-"))
+	if !localePattern.MatchString(locale) {
+		return ""
+	}
+	return locale
+}
+
+// requestLocales lists the locales a request asks for, most preferred first:
+// ?locale= wins over Accept-Language, and DEFAULT_LOCALE applies when neither
+// names one. Each tag is followed by its parent, so "pt-BR" falls back to a
+// "pt" translation.
+func requestLocales(r *http.Request) []string {
+	var tags []string
+	if locale := r.URL.Query().Get("locale"); locale != "" {
+		tags = []string{locale}
+	} else {
+		tags = parseAcceptLanguage(r.Header.Get("Accept-Language"))
+	}
+	if len(tags) == 0 {
+		tags = []string{config.DefaultLocale}
+	}
+	var locales []string
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		locale := normalizeLocale(tag)
+		for locale != "" {
+			if !seen[locale] {
+				seen[locale] = true
+				locales = append(locales, locale)
+			}
+			cut := strings.LastIndex(locale, "-")
+			if cut < 0 {
+				break
+			}
+			locale = locale[:cut]
+		}
+	}
+	return locales
+}
+
+// parseAcceptLanguage returns the tags of an Accept-Language header ordered by
+// quality, dropping "*" and q=0
+func parseAcceptLanguage(header string) []string {
+	type weighted struct {
+		tag     string
+		quality float64
+	}
+	var entries []weighted
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		quality := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			quality = parsed
+		}
+		if tag == "" || tag == "*" || quality <= 0 {
+			continue
+		}
+		entries = append(entries, weighted{tag, quality})
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].quality > entries[j].quality })
+	tags := make([]string, len(entries))
+	for i, entry := range entries {
+		tags[i] = entry.tag
+	}
+	return tags
+}
+
+func (repo *GenericRepository) GetTranslations(productID uint) ([]ProductTranslation, error) {
+	translations := []ProductTranslation{}
+	err := repo.DB.Where("product_id = ?", productID).Order("locale").Find(&translations).Error
+	return translations, err
+}
+
+// SaveTranslation creates or replaces the translation for its locale
+func (repo *GenericRepository) SaveTranslation(translation *ProductTranslation) error {
+	if _, err := repo.GetById(translation.ProductID); err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	translation.CreatedAt, translation.UpdatedAt = now, now
+	return repo.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "product_id"}, {Name: "locale"}},
+		DoUpdates: clause.AssignmentColumns([]string{"name", "description", "updated_at"}),
+	}).Create(translation).Error
+}
+
+func (repo *GenericRepository) DeleteTranslation(productID uint, locale string) (bool, error) {
+	result := repo.DB.Where("product_id = ? AND locale = ?", productID, locale).Delete(&ProductTranslation{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// Localize replaces names and descriptions in place with their translations
+// in locales, which are ordered by preference
+func (repo *GenericRepository) Localize(products []*Product, locales []string) error {
+	if len(products) == 0 || len(locales) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(products))
+	for i, product := range products {
+		ids[i] = product.ID
+	}
+	var translations []ProductTranslation
+	err := repo.DB.Where("product_id IN ? AND locale IN ?", ids, locales).Find(&translations).Error
+	if err != nil {
+		return err
+	}
+	rank := make(map[string]int, len(locales))
+	for i, locale := range locales {
+		rank[locale] = i
+	}
+	// Each field comes from the most preferred translation that sets it
+	sort.Slice(translations, func(i, j int) bool { return rank[translations[i].Locale] < rank[translations[j].Locale] })
+	byProduct := map[uint][]ProductTranslation{}
+	for _, translation := range translations {
+		byProduct[translation.ProductID] = append(byProduct[translation.ProductID], translation)
+	}
+	for _, product := range products {
+		var name, description string
+		for _, translation := range byProduct[product.ID] {
+			if name == "" {
+				name = translation.Name
+			}
+			if description == "" {
+				description = translation.Description
+			}
+		}
+		if name != "" {
+			product.Name = name
+		}
+		if description != "" {
+			product.Description = description
+		}
+	}
+	return nil
+}
+
+// localize translates products for the request's locales. Responses vary on
+// Accept-Language even when nothing was translated.
+func localize(w http.ResponseWriter, r *http.Request, products ...*Product) error {
+	w.Header().Add("Vary", "Accept-Language")
+	return productRepo.WithContext(r.Context()).Localize(products, requestLocales(r))
+}
+
+// localizedModTime is when a localized response last changed: translations
+// are edited without touching the product's own UpdatedAt
+func localizedModTime(r *http.Request, product *Product) time.Time {
+	modified := product.UpdatedAt
+	locales := requestLocales(r)
+	if len(locales) == 0 {
+		return modified
+	}
+	var translation ProductTranslation
+	err := productRepo.WithContext(r.Context()).DB.
+		Where("product_id = ? AND locale IN ?", product.ID, locales).
+		Order("updated_at DESC").First(&translation).Error
+	if err == nil && translation.UpdatedAt.After(modified) {
+		modified = translation.UpdatedAt
+	}
+	return modified
+}
+
+func productPointers(products []Product) []*Product {
+	pointers := make([]*Product, len(products))
+	for i := range products {
+		pointers[i] = &products[i]
+	}
+	return pointers
+}
+
+// Handlers
+func GetProductTranslations(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	productID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+	repo := productRepo.WithContext(r.Context())
+	if _, err := repo.GetById(uint(productID)); err != nil {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+	translations, err := repo.GetTranslations(uint(productID))
+	if err != nil {
+		http.Error(w, "Error fetching translations", http.StatusInternalServerError)
+		return
+	}
+	response := ApiResponse{Success: true, Data: translations, Message: "Translations retrieved successfully"}
+	respondWithJSON(w, r, response)
+}
+
+func PutProductTranslation(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	productID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+	locale := normalizeLocale(vars["locale"])
+	if locale == "" {
+		http.Error(w, "Invalid locale", http.StatusBadRequest)
+		return
+	}
+	var translation ProductTranslation
+	if err := decodeBody(r, &translation); err != nil {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid input", []string{err.Error()})
+		return
+	}
+	if strings.TrimSpace(translation.Name) == "" && strings.TrimSpace(translation.Description) == "" {
+		respondWithError(w, r, http.StatusUnprocessableEntity, "Invalid translation", []string{"name or description is required"})
+		return
+	}
+	translation.ID = 0
+	translation.ProductID = uint(productID)
+	translation.Locale = locale
+	err = productRepo.WithContext(r.Context()).SaveTranslation(&translation)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error saving translation", http.StatusInternalServerError)
+		return
+	}
+	auditChanges(r.Context(), []uint{translation.ProductID}, AuditTranslationSaved, translation)
+	response := ApiResponse{Success: true, Data: translation, Message: "Translation saved successfully"}
+	respondWithJSON(w, r, response)
+}
+
+func DeleteProductTranslation(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	productID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+	locale := normalizeLocale(vars["locale"])
+	deleted, err := productRepo.WithContext(r.Context()).DeleteTranslation(uint(productID), locale)
+	if err != nil {
+		http.Error(w, "Error deleting translation", http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		http.Error(w, "Translation not found", http.StatusNotFound)
+		return
+	}
+	auditChanges(r.Context(), []uint{uint(productID)}, AuditTranslationDeleted, map[string]string{"locale": locale})
+	response := ApiResponse{Success: true, Message: "Translation deleted successfully"}
+	respondWithJSON(w, r, response)
+}
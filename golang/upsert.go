@@ -0,0 +1,248 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const maxUpsertBatchSize = 500
+
+// Columns an upsert overwrites on an existing SKU: the ones a PATCH may
+// change, except the SKU it matched on. Bookkeeping such as created_at and
+// view_count is kept.
+var upsertColumns = func() []string {
+	columns := []string{"search_text", "updated_at"}
+	for name := range patchableFields {
+		if name != "sku" {
+			columns = append(columns, name)
+		}
+	}
+	sort.Strings(columns)
+	return columns
+}()
+
+type UpsertResult struct {
+	Index   int      `json:"index"`
+	SKU     string   `json:"sku"`
+	Status  string   `json:"status,omitempty"`
+	Product *Product `json:"product,omitempty"`
+	Errors  []string `json:"errors,omitempty"`
+}
+
+var (
+	errUpsertInvalid   = errors.New("upsert batch has invalid items")
+	errUpsertForbidden = errors.New("upsert batch sets fields the caller can't change")
+)
+
+// Upsert item statuses
+const (
+	UpsertCreated = "created"
+	UpsertUpdated = "updated"
+	UpsertFailed  = "failed"
+)
+
+// UpsertBySKU inserts or updates each product matched by SKU in a single
+// transaction. The conflict target is the partial index on active SKUs, so a
+// deleted product's SKU is inserted as a new product. Any invalid item fails
+// the whole batch with errUpsertInvalid and the results say which, unless
+// bestEffort is set: then the valid items are saved and the others marked
+// failed.
+//
+// authorize is called with each item and the stored product it updates, nil
+// for a new SKU, and reports the fields the caller may not set; any such item
+// fails the batch with errUpsertForbidden, best effort or not.
+func (repo *GenericRepository) UpsertBySKU(products []Product, bestEffort bool, authorize func(i int, product, stored *Product) []string) ([]UpsertResult, error) {
+	results := make([]UpsertResult, len(products))
+	err := repo.DB.Transaction(func(tx *gorm.DB) error {
+		txRepo := &GenericRepository{DB: tx}
+		skus := make([]string, len(products))
+		for i := range products {
+			skus[i] = products[i].SKU
+		}
+		var existing []Product
+		err := tx.Where("sku IN ? AND is_deleted = ?", skus, false).Find(&existing).Error
+		if err != nil {
+			return err
+		}
+		existingIDs := make(map[string]uint, len(existing))
+		existingBySKU := make(map[string]*Product, len(existing))
+		for i := range existing {
+			existingIDs[existing[i].SKU] = existing[i].ID
+			existingBySKU[existing[i].SKU] = &existing[i]
+		}
+
+		forbidden := false
+		for i := range products {
+			if errs := authorize(i, &products[i], existingBySKU[products[i].SKU]); len(errs) > 0 {
+				results[i] = UpsertResult{Index: i, SKU: products[i].SKU, Status: UpsertFailed, Errors: errs}
+				forbidden = true
+			}
+		}
+		if forbidden {
+			return errUpsertForbidden
+		}
+
+		invalid := false
+		seen := map[string]bool{}
+		for i := range products {
+			product := &products[i]
+			product.ID = existingIDs[product.SKU]
+			product.IsDeleted = false
+			product.DeletedAt = nil
+			product.DeletedReason = ""
+			results[i] = UpsertResult{Index: i, SKU: product.SKU, Errors: product.Validate()}
+			switch {
+			case product.SKU == "":
+				results[i].Errors = append(results[i].Errors, "sku is required")
+			case seen[product.SKU]:
+				results[i].Errors = append(results[i].Errors, "sku appears more than once in the batch")
+			}
+			seen[product.SKU] = true
+			if err := txRepo.checkConflicts(product); errors.Is(err, ErrDuplicateName) {
+				results[i].Errors = append(results[i].Errors, conflictMessage(err))
+			} else if err != nil && !errors.Is(err, ErrDuplicateSKU) {
+				return err
+			}
+			// The ids are zeroed for the insert below, so BeforeSave can't
+			// tell an update and the stock check runs here
+			if product.ID != 0 {
+				if err := checkWarehouseStock(tx, product.ID, product.StockQuantity); errors.Is(err, ErrStockBelowWarehouses) {
+					results[i].Errors = append(results[i].Errors, conflictMessage(err))
+				} else if err != nil {
+					return err
+				}
+			}
+			if len(results[i].Errors) > 0 {
+				results[i].Status = UpsertFailed
+				invalid = true
+			}
+		}
+		if invalid && !bestEffort {
+			return errUpsertInvalid
+		}
+
+		// Let the insert assign ids; the conflict clause finds existing rows
+		var valid []Product
+		var validSKUs []string
+		for i := range products {
+			if results[i].Status != UpsertFailed {
+				products[i].ID = 0
+				valid = append(valid, products[i])
+				validSKUs = append(validSKUs, products[i].SKU)
+			}
+		}
+		if len(valid) == 0 {
+			return nil
+		}
+		err = tx.Clauses(clause.OnConflict{
+			Columns:     []clause.Column{{Name: "sku"}},
+			TargetWhere: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "is_deleted = false AND sku <> ''"}}},
+			DoUpdates:   clause.AssignmentColumns(upsertColumns),
+		}).Create(&valid).Error
+		if err != nil {
+			return translateProductError(err)
+		}
+
+		// Reload, since the inserted values don't show what an update kept
+		var stored []Product
+		if err := tx.Where("sku IN ? AND is_deleted = ?", validSKUs, false).Find(&stored).Error; err != nil {
+			return err
+		}
+		bySKU := make(map[string]Product, len(stored))
+		for _, product := range stored {
+			bySKU[product.SKU] = product
+		}
+		for i := range results {
+			if results[i].Status == UpsertFailed {
+				continue
+			}
+			product := bySKU[results[i].SKU]
+			results[i].Product = &product
+			results[i].Status = UpsertCreated
+			if _, ok := existingIDs[results[i].SKU]; ok {
+				results[i].Status = UpsertUpdated
+			}
+		}
+		return nil
+	})
+	return results, err
+}
+
+// Handlers
+
+// UpsertProducts answers 200 when every item was saved. With best_effort
+// some may have failed: then it's a 207 and each result carries its index
+// and status.
+//
+// An item matching an existing SKU replaces the product like a PUT: every
+// column in upsertColumns is written, so fields the item leaves out, such as
+// category_id, cost or reorder_point, are reset to zero or null. Only the
+// restricted fields the caller can't change are kept.
+func UpsertProducts(w http.ResponseWriter, r *http.Request) {
+	params := NewQueryParams(r)
+	bestEffort := params.Bool("best_effort", false)
+	if !params.Valid() {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid query parameters", params.Errors)
+		return
+	}
+	var products []Product
+	fields, err := decodeBodyItemFields(r, &products)
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid input", []string{err.Error()})
+		return
+	}
+	if len(products) == 0 || len(products) > maxUpsertBatchSize {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid input", []string{fmt.Sprintf("batch must contain between 1 and %d products", maxUpsertBatchSize)})
+		return
+	}
+	authorize := func(i int, product, stored *Product) []string {
+		return checkFieldPermissions(r.Context(), fields[i], product, stored)
+	}
+	results, err := productRepo.WithContext(r.Context()).UpsertBySKU(products, bestEffort, authorize)
+	if errors.Is(err, errUpsertInvalid) || errors.Is(err, errUpsertForbidden) {
+		var errs []string
+		for _, result := range results {
+			for _, message := range result.Errors {
+				errs = append(errs, fmt.Sprintf("item %d (sku %q): %s", result.Index, result.SKU, message))
+			}
+		}
+		if errors.Is(err, errUpsertForbidden) {
+			respondWithError(w, r, http.StatusForbidden, "Forbidden", errs)
+			return
+		}
+		respondWithValidationErrors(w, r, errs)
+		return
+	}
+	if message := conflictMessage(err); message != "" {
+		http.Error(w, message, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error upserting products", http.StatusInternalServerError)
+		return
+	}
+	failed := 0
+	for _, result := range results {
+		switch result.Status {
+		case UpsertCreated:
+			emitEvent(r.Context(), EventProductCreated, result.Product)
+		case UpsertUpdated:
+			emitEvent(r.Context(), EventProductUpdated, result.Product)
+		default:
+			failed++
+		}
+	}
+	if failed > 0 {
+		message := fmt.Sprintf("%d saved, %d failed", len(results)-failed, failed)
+		response := ApiResponse{Success: true, Data: results, Message: message}
+		respondWithJSONStatus(w, r, http.StatusMultiStatus, response)
+		return
+	}
+	response := ApiResponse{Success: true, Data: results, Message: "Products upserted successfully"}
+	respondWithJSON(w, r, response)
+}
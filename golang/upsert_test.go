@@ -0,0 +1,51 @@
+package main
+
+import "testing"
+
+func TestUpsertUpdatesEveryPatchableColumn(t *testing.T) {
+	setupTestDB(t)
+	keys, err := NewKeyring([]string{"test:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="}, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := fieldKeys
+	fieldKeys = keys
+	t.Cleanup(func() { fieldKeys = previous })
+	allow := func(i int, product, stored *Product) []string { return nil }
+	if _, err = productRepo.UpsertBySKU([]Product{{Name: "Widget", SKU: "W-1", Price: 10}}, false, allow); err != nil {
+		t.Fatal(err)
+	}
+
+	cost, point, target := Price(4), 2, 8
+	update := Product{Name: "Widget", SKU: "W-1", Price: 12, Cost: &cost, ReorderPoint: &point, ReorderTarget: &target}
+	update.SupplierCost.Plain = 3.5
+	results, err := productRepo.UpsertBySKU([]Product{update}, false, allow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Status != UpsertUpdated {
+		t.Fatalf("got status %q", results[0].Status)
+	}
+	stored, err := productRepo.GetById(results[0].Product.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	switch {
+	case stored.Price != 12:
+		t.Errorf("price: got %v", stored.Price)
+	case stored.Cost == nil || *stored.Cost != cost:
+		t.Errorf("cost: got %v", stored.Cost)
+	case stored.ReorderPoint == nil || *stored.ReorderPoint != point || stored.ReorderTarget == nil || *stored.ReorderTarget != target:
+		t.Errorf("reorder point and target: got %v, %v", stored.ReorderPoint, stored.ReorderTarget)
+	case stored.SupplierCost.Plain != 3.5:
+		t.Errorf("supplier cost: got %v", stored.SupplierCost.Plain)
+	}
+
+	// Items replace the product, so what they leave out is reset
+	if _, err := productRepo.UpsertBySKU([]Product{{Name: "Widget", SKU: "W-1", Price: 12}}, false, allow); err != nil {
+		t.Fatal(err)
+	}
+	if stored, _ = productRepo.GetById(stored.ID); stored.Cost != nil || stored.ReorderPoint != nil || stored.SupplierCost.Plain != 0 {
+		t.Errorf("left out fields: got cost %v, reorder point %v, supplier cost %v", stored.Cost, stored.ReorderPoint, stored.SupplierCost.Plain)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Validate checks the business rules every stored product must satisfy and
+// returns one message per problem
+func (product *Product) Validate() []string {
+	var errs []string
+	if strings.TrimSpace(product.Name) == "" {
+		errs = append(errs, "name is required")
+	}
+	if product.Price < 0 {
+		errs = append(errs, "price must not be negative")
+	}
+	if product.StockQuantity < 0 {
+		errs = append(errs, "stock_quantity must not be negative")
+	}
+	if product.Cost != nil && *product.Cost < 0 {
+		errs = append(errs, "cost must not be negative")
+	}
+	if product.SupplierCost.Plain < 0 {
+		errs = append(errs, "supplier_cost must not be negative")
+	}
+	if !product.SupplierCost.IsZero() && fieldKeys == nil {
+		errs = append(errs, "supplier_cost can't be stored without FIELD_ENCRYPTION_KEYS")
+	}
+	switch {
+	case product.ReorderPoint == nil && product.ReorderTarget != nil:
+		errs = append(errs, "reorder_target needs a reorder_point")
+	case product.ReorderPoint != nil && product.ReorderTarget == nil:
+		errs = append(errs, "reorder_point needs a reorder_target")
+	case product.ReorderPoint != nil:
+		if *product.ReorderPoint < 0 {
+			errs = append(errs, "reorder_point must not be negative")
+		}
+		if *product.ReorderTarget <= *product.ReorderPoint {
+			errs = append(errs, "reorder_target must be greater than reorder_point")
+		}
+	}
+	return errs
+}
+
+// Warnings flags products that can be saved but are probably incomplete
+func (product *Product) Warnings() []string {
+	var warnings []string
+	if product.SKU == "" {
+		warnings = append(warnings, "sku is empty")
+	}
+	if strings.TrimSpace(product.Description) == "" {
+		warnings = append(warnings, "description is empty")
+	}
+	if product.Price == 0 {
+		warnings = append(warnings, "price is zero")
+	}
+	return warnings
+}
+
+type ProductValidation struct {
+	Valid    bool     `json:"valid"`
+	Errors   []string `json:"errors"`
+	Warnings []string `json:"warnings"`
+}
+
+// ValidateProduct runs the create checks, uniqueness included, without
+// saving. An id in the product makes it validate as an update of that product.
+func (repo *GenericRepository) ValidateProduct(product *Product) (*ProductValidation, error) {
+	validation := &ProductValidation{Errors: product.Validate(), Warnings: product.Warnings()}
+	err := repo.checkConflicts(product)
+	if message := conflictMessage(err); message != "" {
+		validation.Errors = append(validation.Errors, message)
+	} else if err != nil {
+		return nil, err
+	}
+	if validation.Errors == nil {
+		validation.Errors = []string{}
+	}
+	if validation.Warnings == nil {
+		validation.Warnings = []string{}
+	}
+	validation.Valid = len(validation.Errors) == 0
+	return validation, nil
+}
+
+// Handlers
+func ValidateProduct(w http.ResponseWriter, r *http.Request) {
+	var product Product
+	if err := decodeBody(r, &product); err != nil {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid input", []string{err.Error()})
+		return
+	}
+	validation, err := productRepo.WithContext(r.Context()).ValidateProduct(&product)
+	if err != nil {
+		http.Error(w, "Error validating product", http.StatusInternalServerError)
+		return
+	}
+	response := ApiResponse{Success: true, Data: validation, Message: "Product validated"}
+	respondWithJSON(w, r, response)
+}
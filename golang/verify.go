@@ -0,0 +1,178 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Offending ids listed per check; the count keeps going past it
+const maxIntegrityIDs = 100
+
+type IntegrityCheck struct {
+	Name     string `json:"name"`
+	Found    int    `json:"found"`
+	Repaired int    `json:"repaired"`
+	IDs      []uint `json:"ids"`
+}
+
+type IntegrityReport struct {
+	Repair bool             `json:"repair"`
+	Checks []IntegrityCheck `json:"checks"`
+}
+
+// integrityCheck finds the ids of offending rows and, on repair, fixes them.
+// Repairs bump updated_at so clients don't revalidate stale copies, and are
+// audited against the products they touch; products maps the ids to those
+// when they aren't product ids.
+type integrityCheck struct {
+	name     string
+	find     func(tx *gorm.DB) ([]uint, error)
+	repair   func(tx *gorm.DB, ids []uint) error
+	products func(tx *gorm.DB, ids []uint) ([]uint, error)
+}
+
+var integrityChecks = []integrityCheck{
+	{
+		// Products pointing at a category that no longer exists are moved
+		// out of any category
+		name: "missing_category",
+		find: func(tx *gorm.DB) ([]uint, error) {
+			var ids []uint
+			err := tx.Model(&Product{}).
+				Where("category_id IS NOT NULL AND category_id NOT IN (?)", tx.Model(&Category{}).Select("id")).
+				Order("id").Pluck("id", &ids).Error
+			return ids, err
+		},
+		repair: func(tx *gorm.DB, ids []uint) error {
+			return tx.Model(&Product{}).Where("id IN ?", ids).
+				UpdateColumns(map[string]interface{}{"category_id": nil, "updated_at": time.Now().UTC()}).Error
+		},
+	},
+	{
+		// Stock is reset to zero, recorded in the ledger
+		name: "negative_stock",
+		find: func(tx *gorm.DB) ([]uint, error) {
+			var ids []uint
+			err := tx.Model(&Product{}).Where("stock_quantity < 0").Order("id").Pluck("id", &ids).Error
+			return ids, err
+		},
+		repair: func(tx *gorm.DB, ids []uint) error {
+			var products []Product
+			if err := tx.Select("id", "stock_quantity").Where("id IN ?", ids).Find(&products).Error; err != nil {
+				return err
+			}
+			for _, product := range products {
+				err := tx.Model(&Product{}).Where("id = ?", product.ID).
+					UpdateColumns(map[string]interface{}{"stock_quantity": 0, "updated_at": time.Now().UTC()}).Error
+				if err != nil {
+					return err
+				}
+				movement := StockMovement{ProductID: product.ID, Delta: -product.StockQuantity, Reason: "integrity repair", Quantity: 0}
+				if err := tx.Create(&movement).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		// Images of products that were hard-deleted are deleted too
+		name: "orphaned_images",
+		find: func(tx *gorm.DB) ([]uint, error) {
+			var ids []uint
+			err := tx.Model(&ProductImage{}).
+				Where("product_id NOT IN (?)", tx.Model(&Product{}).Select("id")).
+				Order("id").Pluck("id", &ids).Error
+			return ids, err
+		},
+		repair: func(tx *gorm.DB, ids []uint) error {
+			return tx.Where("id IN ?", ids).Delete(&ProductImage{}).Error
+		},
+		products: func(tx *gorm.DB, ids []uint) ([]uint, error) {
+			var productIDs []uint
+			err := tx.Model(&ProductImage{}).Where("id IN ?", ids).Distinct().Order("product_id").Pluck("product_id", &productIDs).Error
+			return productIDs, err
+		},
+	},
+}
+
+// runIntegrityChecks runs every check against tx, repairing what it finds
+// when repair is set
+func runIntegrityChecks(tx *gorm.DB, repair bool) (*IntegrityReport, error) {
+	report := &IntegrityReport{Repair: repair, Checks: []IntegrityCheck{}}
+	for _, check := range integrityChecks {
+		ids, err := check.find(tx)
+		if err != nil {
+			return nil, err
+		}
+		result := IntegrityCheck{Name: check.name, Found: len(ids), IDs: ids}
+		if repair && len(ids) > 0 {
+			productIDs := ids
+			if check.products != nil {
+				if productIDs, err = check.products(tx, ids); err != nil {
+					return nil, err
+				}
+			}
+			if err := check.repair(tx, ids); err != nil {
+				return nil, err
+			}
+			result.Repaired = len(ids)
+			writeAudit(tx, productIDs, AuditIntegrityRepaired, map[string]string{"check": check.name})
+		}
+		if len(result.IDs) > maxIntegrityIDs {
+			result.IDs = result.IDs[:maxIntegrityIDs]
+		}
+		if result.IDs == nil {
+			result.IDs = []uint{}
+		}
+		report.Checks = append(report.Checks, result)
+	}
+	return report, nil
+}
+
+// Verify scans for data drift. Repairs run in one transaction, so they are
+// either all applied or none is.
+func (repo *GenericRepository) Verify(repair bool) (*IntegrityReport, error) {
+	if !repair {
+		return runIntegrityChecks(repo.DB, false)
+	}
+	var report *IntegrityReport
+	err := repo.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		report, err = runIntegrityChecks(tx, true)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, check := range report.Checks {
+		if check.Repaired > 0 {
+			log.Printf("Verify: repaired %d rows failing %s", check.Repaired, check.Name)
+		}
+	}
+	return report, nil
+}
+
+// Handlers
+func VerifyIntegrity(w http.ResponseWriter, r *http.Request) {
+	params := NewQueryParams(r)
+	repair := params.Bool("repair", false)
+	if !params.Valid() {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid query parameters", params.Errors)
+		return
+	}
+	report, err := productRepo.WithContext(r.Context()).Verify(repair)
+	if err != nil {
+		http.Error(w, "Error verifying data", http.StatusInternalServerError)
+		return
+	}
+	message := "Data verified successfully"
+	if repair {
+		message = "Data verified and repaired successfully"
+	}
+	response := ApiResponse{Success: true, Data: report, Message: message}
+	respondWithJSON(w, r, response)
+}
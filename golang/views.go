@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// RecordView increments the view counter in a single UPDATE, so concurrent
+// views are never lost. UpdateColumn leaves updated_at alone: a view isn't
+// an edit and must not break If-Unmodified-Since for writers.
+func (repo *GenericRepository) RecordView(id uint) (int, error) {
+	result := repo.DB.Model(&Product{}).
+		Where("id = ? AND is_deleted = ?", id, false).
+		UpdateColumn("view_count", gorm.Expr("view_count + 1"))
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return 0, gorm.ErrRecordNotFound
+	}
+	var product Product
+	if err := repo.DB.Select("view_count").First(&product, id).Error; err != nil {
+		return 0, err
+	}
+	return product.ViewCount, nil
+}
+
+// Handlers
+func RecordProductView(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	productID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+	views, err := productRepo.WithContext(r.Context()).RecordView(uint(productID))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error recording view", http.StatusInternalServerError)
+		return
+	}
+	response := ApiResponse{Success: true, Data: map[string]int{"view_count": views}, Message: "View recorded"}
+	respondWithJSON(w, r, response)
+}
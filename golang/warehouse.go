@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// WarehouseStock is the part of a product's stock held at one warehouse.
+// Product.StockQuantity stays the total, so stock not assigned to any
+// warehouse is the difference.
+type WarehouseStock struct {
+	ProductID   uint   `json:"product_id" gorm:"primaryKey"`
+	WarehouseID string `json:"warehouse_id" gorm:"primaryKey"`
+	Quantity    int    `json:"quantity" gorm:"not null"`
+}
+
+// ErrStockBelowWarehouses is returned when a write would set a product's
+// total below what its warehouses hold
+var ErrStockBelowWarehouses = errors.New("stock quantity is below the warehouse stock")
+
+// warehouseStockTotal is the stock a product holds across its warehouses
+func warehouseStockTotal(tx *gorm.DB, productID uint) (int, error) {
+	var total int
+	err := tx.Model(&WarehouseStock{}).Where("product_id = ?", productID).
+		Select("COALESCE(SUM(quantity), 0)").Scan(&total).Error
+	return total, err
+}
+
+// checkWarehouseStock keeps the total at or above the warehouse stock on
+// writes that set stock_quantity directly
+func checkWarehouseStock(tx *gorm.DB, productID uint, stock int) error {
+	held, err := warehouseStockTotal(tx, productID)
+	if err != nil {
+		return err
+	}
+	if stock < held {
+		return ErrStockBelowWarehouses
+	}
+	return nil
+}
+
+func (repo *GenericRepository) GetWarehouseStock(productID uint, warehouseID string) (int, error) {
+	var stock WarehouseStock
+	err := repo.DB.Where("product_id = ? AND warehouse_id = ?", productID, warehouseID).First(&stock).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, nil
+	}
+	return stock.Quantity, err
+}
+
+func (repo *GenericRepository) GetWarehouseStocks(productID uint) ([]WarehouseStock, error) {
+	stocks := []WarehouseStock{}
+	err := repo.DB.Where("product_id = ?", productID).Order("warehouse_id").Find(&stocks).Error
+	return stocks, err
+}
+
+// AdjustWarehouseStock applies a delta to one warehouse and to the product's
+// total together. It runs in its own (nested) transaction so a refused
+// adjustment never leaves the two out of step.
+func (repo *GenericRepository) AdjustWarehouseStock(productID uint, warehouseID string, delta int, reason string) (int, int, error) {
+	var total, quantity int
+	err := repo.DB.Transaction(func(tx *gorm.DB) error {
+		txRepo := &GenericRepository{DB: tx}
+		var err error
+		if delta >= 0 {
+			err = tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "product_id"}, {Name: "warehouse_id"}},
+				DoUpdates: clause.Assignments(map[string]interface{}{"quantity": gorm.Expr("warehouse_stocks.quantity + ?", delta)}),
+			}).Create(&WarehouseStock{ProductID: productID, WarehouseID: warehouseID, Quantity: delta}).Error
+		} else {
+			result := tx.Model(&WarehouseStock{}).
+				Where("product_id = ? AND warehouse_id = ? AND quantity + ? >= 0", productID, warehouseID, delta).
+				Update("quantity", gorm.Expr("quantity + ?", delta))
+			err = result.Error
+			if err == nil && result.RowsAffected == 0 {
+				err = ErrInsufficientStock
+			}
+		}
+		if err != nil {
+			return err
+		}
+		// The total goes second so its check sees the new warehouse quantity
+		total, err = txRepo.adjustStock(StockMovement{ProductID: productID, Delta: delta, Reason: reason, WarehouseID: warehouseID})
+		if err != nil {
+			return err
+		}
+		quantity, err = txRepo.GetWarehouseStock(productID, warehouseID)
+		return err
+	})
+	if errors.Is(err, ErrInsufficientStock) {
+		// Report what the warehouse has, as the rolled back total is moot
+		quantity, _ = repo.GetWarehouseStock(productID, warehouseID)
+	}
+	return total, quantity, err
+}
+
+// Handlers
+func GetProductWarehouses(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	productID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+	repo := productRepo.WithContext(r.Context())
+	if _, err := repo.GetStock(uint(productID)); err != nil {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+	stocks, err := repo.GetWarehouseStocks(uint(productID))
+	if err != nil {
+		http.Error(w, "Error fetching warehouse stock", http.StatusInternalServerError)
+		return
+	}
+	response := ApiResponse{Success: true, Data: stocks, Message: "Warehouse stock retrieved successfully"}
+	respondWithJSON(w, r, response)
+}
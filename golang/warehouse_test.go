@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+// createStockedProduct creates a product holding stock, part of it at a
+// warehouse
+func createStockedProduct(t *testing.T, sku string, stock int, warehouse string, held int) Product {
+	t.Helper()
+	w := serve(CreateProduct, "POST", "/products", map[string]interface{}{"name": sku, "sku": sku, "price": 5, "stock_quantity": stock}, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("create %s: got %d: %s", sku, w.Code, w.Body)
+	}
+	product := decodeProduct(t, w)
+	if _, _, err := productRepo.AdjustWarehouseStock(product.ID, warehouse, held, "test"); err != nil {
+		t.Fatal(err)
+	}
+	// The warehouse adjustment adds to the total too
+	if _, err := productRepo.AdjustStock(product.ID, -held, "test"); err != nil {
+		t.Fatal(err)
+	}
+	return product
+}
+
+func TestStockCannotDropBelowWarehouseStock(t *testing.T) {
+	setupTestDB(t)
+	product := createStockedProduct(t, "W-1", 10, "north", 6)
+	id := strconv.Itoa(int(product.ID))
+	vars := map[string]string{"id": id}
+
+	w := serve(UpdateProduct, "PUT", "/products/"+id, map[string]interface{}{"name": "W-1", "sku": "W-1", "price": 5, "stock_quantity": 5}, vars)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("PUT below warehouse stock: got %d: %s", w.Code, w.Body)
+	}
+	if w = serve(PatchProduct, "PATCH", "/products/"+id, map[string]interface{}{"stock_quantity": 5}, vars); w.Code != http.StatusConflict {
+		t.Fatalf("PATCH below warehouse stock: got %d: %s", w.Code, w.Body)
+	}
+	w = serve(UpsertProducts, "POST", "/products/upsert", []map[string]interface{}{{"name": "W-1", "sku": "W-1", "price": 5, "stock_quantity": 5}}, nil)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("upsert below warehouse stock: got %d: %s", w.Code, w.Body)
+	}
+	if w = serve(PatchProduct, "PATCH", "/products/"+id, map[string]interface{}{"stock_quantity": 6}, vars); w.Code != http.StatusOK {
+		t.Fatalf("PATCH to the warehouse stock: got %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestMergeMovesWarehouseStockTranslationsAndTiers(t *testing.T) {
+	setupTestDB(t)
+	survivor := createStockedProduct(t, "S-1", 4, "north", 3)
+	merged := createStockedProduct(t, "M-1", 5, "north", 2)
+	if _, _, err := productRepo.AdjustWarehouseStock(merged.ID, "south", 1, "test"); err != nil {
+		t.Fatal(err)
+	}
+	translations := []ProductTranslation{
+		{ProductID: survivor.ID, Locale: "pt", Name: "kept"},
+		{ProductID: merged.ID, Locale: "pt", Name: "dropped"},
+		{ProductID: merged.ID, Locale: "es", Name: "moved"},
+	}
+	tiers := []PriceTier{
+		{ProductID: survivor.ID, MinQuantity: 10, UnitPrice: 4},
+		{ProductID: merged.ID, MinQuantity: 10, UnitPrice: 3},
+		{ProductID: merged.ID, MinQuantity: 50, UnitPrice: 2},
+	}
+	if err := db.Create(&translations).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&tiers).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := productRepo.Merge(survivor.ID, []uint{merged.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	stocks, err := productRepo.GetWarehouseStocks(survivor.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stocks) != 2 || stocks[0].Quantity != 5 || stocks[1].Quantity != 1 {
+		t.Fatalf("survivor warehouse stock: got %+v", stocks)
+	}
+	if left, _ := productRepo.GetWarehouseStocks(merged.ID); len(left) != 0 {
+		t.Fatalf("merged product kept warehouse stock %+v", left)
+	}
+	stock, err := productRepo.GetStock(survivor.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stock != 10 {
+		t.Fatalf("survivor stock: got %d, want 10", stock)
+	}
+
+	var names []string
+	db.Model(&ProductTranslation{}).Where("product_id = ?", survivor.ID).Order("locale").Pluck("name", &names)
+	if len(names) != 2 || names[0] != "moved" || names[1] != "kept" {
+		t.Fatalf("survivor translations: got %v", names)
+	}
+	var prices []float64
+	db.Model(&PriceTier{}).Where("product_id = ?", survivor.ID).Order("min_quantity").Pluck("unit_price", &prices)
+	if len(prices) != 2 || prices[0] != 4 || prices[1] != 2 {
+		t.Fatalf("survivor tiers: got %v", prices)
+	}
+}
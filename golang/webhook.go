@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	webhookQueueSize   = 256
+	webhookMaxAttempts = 3
+	webhookTimeout     = 5 * time.Second
+)
+
+// Event types sent to webhooks
+const (
+	EventProductCreated  = "product.created"
+	EventProductUpdated  = "product.updated"
+	EventProductDeleted  = "product.deleted"
+	EventProductRestored = "product.restored"
+)
+
+type ProductEvent struct {
+	Type       string      `json:"type"`
+	Product    interface{} `json:"product"`
+	OccurredAt time.Time   `json:"occurred_at"`
+}
+
+// WebhookDispatcher posts product events to the configured URLs from a
+// background worker. Requests never wait on delivery: when the queue is full
+// the event is dropped and logged.
+type WebhookDispatcher struct {
+	urls   []string
+	queue  chan ProductEvent
+	client *http.Client
+	// mu guards closed, so a request still running at shutdown can't send
+	// on the closed queue
+	mu     sync.Mutex
+	closed bool
+}
+
+func NewWebhookDispatcher(urls []string) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		urls:   urls,
+		queue:  make(chan ProductEvent, webhookQueueSize),
+		client: &http.Client{Timeout: webhookTimeout},
+	}
+}
+
+var webhooks *WebhookDispatcher
+
+// Start delivers queued events until Close is called
+func (d *WebhookDispatcher) Start(wg *sync.WaitGroup) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for event := range d.queue {
+			body, err := json.Marshal(event)
+			if err != nil {
+				log.Println("Error encoding webhook event: ", err)
+				continue
+			}
+			for _, url := range d.urls {
+				if err := d.deliver(url, body); err != nil {
+					log.Printf("Webhook %s to %s failed: %v", event.Type, url, err)
+				}
+			}
+		}
+	}()
+}
+
+// Close stops accepting events; the worker exits once the queue is drained
+func (d *WebhookDispatcher) Close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.closed = true
+	close(d.queue)
+}
+
+// Dispatch queues an event, a no-op when no webhook URLs are configured
+func (d *WebhookDispatcher) Dispatch(eventType string, product interface{}) {
+	if d == nil || len(d.urls) == 0 {
+		return
+	}
+	event := ProductEvent{Type: eventType, Product: product, OccurredAt: time.Now().UTC()}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		log.Printf("Shutting down, dropping %s webhook event", eventType)
+		return
+	}
+	select {
+	case d.queue <- event:
+	default:
+		log.Printf("Webhook queue full, dropping %s event", eventType)
+	}
+}
+
+func (d *WebhookDispatcher) deliver(url string, body []byte) error {
+	var err error
+	for attempt := 1; attempt <= webhookMaxAttempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(time.Duration(attempt-1) * time.Second)
+		}
+		var resp *http.Response
+		resp, err = d.client.Post(url, "application/json", bytes.NewReader(body))
+		if err != nil {
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 300 {
+			return nil
+		}
+		err = fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return fmt.Errorf("giving up after %d attempts: %w", webhookMaxAttempts, err)
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"sync"
+	"testing"
+)
+
+type nopBroker struct{}
+
+func (nopBroker) Publish(subject string, data []byte) error { return nil }
+func (nopBroker) Close() error                              { return nil }
+
+// Requests still running after shutdown must not panic on the closed queues
+func TestPublishAfterClose(t *testing.T) {
+	var wg sync.WaitGroup
+	dispatcher := NewWebhookDispatcher([]string{"http://127.0.0.1:0"})
+	dispatcher.Start(&wg)
+	publisher := NewEventPublisher(nopBroker{}, "catalog")
+	publisher.Start(&wg)
+
+	dispatcher.Close()
+	publisher.Close()
+	dispatcher.Dispatch(EventProductCreated, &Product{ID: 1})
+	publisher.Publish(EventProductCreated, &Product{ID: 1})
+	wg.Wait()
+}